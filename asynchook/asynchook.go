@@ -0,0 +1,268 @@
+package asynchook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy decides what happens to a record when the queue is full
+type OverflowPolicy int
+
+const (
+	// The new record is dropped
+	DropNewest OverflowPolicy = iota
+	// The oldest queued record is dropped to make room for the new record
+	DropOldest
+	// The caller blocks until there is room in the queue
+	Block
+)
+
+// AsyncHook fires the records of the wrapped hook on worker goroutines so
+// logging does not wait for the wrapped hook
+type AsyncHook struct {
+	// Accessed atomically, first for 64 bit alignment on 32 bit platforms
+	enqueued int64
+	fired    int64
+	failed   int64
+	dropped  int64
+
+	hook  logrus.Hook
+	opts  Options
+	queue chan *logrus.Entry
+
+	// Sync stuff
+	mutex   sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+	pending sync.Mutex
+	count   int
+	idle    chan struct{}
+}
+
+type Options struct {
+	// Number of records queued before the OverflowPolicy applies, defaults to 1000
+	QueueSize int
+	// Number of goroutines firing the wrapped hook, defaults to 1. Records are
+	// only fired in the order they were logged with a single worker.
+	Workers int
+	// Defaults to DropNewest
+	Overflow OverflowPolicy
+	// Called with the errors returned by the wrapped hook, defaults to
+	// writing the error to stderr
+	ErrorHandler func(err error)
+	// How long Close() waits for the queued records to be fired, defaults to
+	// 5 seconds
+	CloseTimeout time.Duration
+}
+
+// Stats are the counters returned by Stats()
+type Stats struct {
+	// Records waiting in the queue
+	Queued int
+	// Records accepted into the queue
+	Enqueued int64
+	// Records fired without error
+	Fired int64
+	// Records the wrapped hook returned an error for
+	Failed int64
+	// Records dropped because the queue was full
+	Dropped int64
+}
+
+// Wrap returns a hook which fires the records of the hook asynchronously
+func Wrap(hook logrus.Hook, opts Options) *AsyncHook {
+	setter.SetDefault(&opts.QueueSize, 1000)
+	setter.SetDefault(&opts.Workers, 1)
+	setter.SetDefault(&opts.CloseTimeout, 5*time.Second)
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(err error) {
+			_, _ = fmt.Fprintf(os.Stderr, "[asynchook] %s\n", err)
+		}
+	}
+
+	h := AsyncHook{
+		hook:    hook,
+		opts:    opts,
+		queue:   make(chan *logrus.Entry, opts.QueueSize),
+		idle:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for entry := range h.queue {
+				if err := h.hook.Fire(entry); err != nil {
+					atomic.AddInt64(&h.failed, 1)
+					h.opts.ErrorHandler(err)
+				} else {
+					atomic.AddInt64(&h.fired, 1)
+				}
+				h.done()
+			}
+		}()
+	}
+	return &h
+}
+
+// Fire queues a copy of the entry, the wrapped hook is fired with the copy
+// on a worker goroutine
+func (h *AsyncHook) Fire(entry *logrus.Entry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+
+	dup := common.CopyEntry(entry)
+	h.add()
+
+	if h.opts.Overflow == Block {
+		// Close() unblocks the callers waiting for room in the queue
+		select {
+		case h.queue <- dup:
+			atomic.AddInt64(&h.enqueued, 1)
+			return nil
+		case <-h.closing:
+			atomic.AddInt64(&h.dropped, 1)
+			h.done()
+			return errors.New("hook is closed")
+		}
+	}
+
+	select {
+	case h.queue <- dup:
+		atomic.AddInt64(&h.enqueued, 1)
+		return nil
+	default:
+	}
+
+	if h.opts.Overflow == DropOldest {
+		select {
+		case <-h.queue:
+			atomic.AddInt64(&h.dropped, 1)
+			h.done()
+		default:
+		}
+		select {
+		case h.queue <- dup:
+			atomic.AddInt64(&h.enqueued, 1)
+			return nil
+		default:
+		}
+	}
+
+	atomic.AddInt64(&h.dropped, 1)
+	h.done()
+	return nil
+}
+
+// Counts records which are queued or being fired
+func (h *AsyncHook) add() {
+	h.pending.Lock()
+	h.count++
+	h.pending.Unlock()
+}
+
+func (h *AsyncHook) done() {
+	h.pending.Lock()
+	defer h.pending.Unlock()
+	h.count--
+	if h.count == 0 {
+		close(h.idle)
+		h.idle = make(chan struct{})
+	}
+}
+
+// Flush waits until every queued record has been fired or the context is done
+func (h *AsyncHook) Flush(ctx context.Context) error {
+	h.pending.Lock()
+	if h.count == 0 {
+		h.pending.Unlock()
+		return nil
+	}
+	idle := h.idle
+	h.pending.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close is CloseContext with a context which times out after
+// Options.CloseTimeout
+func (h *AsyncHook) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.CloseTimeout)
+	defer cancel()
+	return h.CloseContext(ctx)
+}
+
+// CloseContext stops accepting records, waits until every queued record has
+// been fired then closes the wrapped hook if it has a `Close() error` method.
+// If the context is done first the context error is returned and the
+// remaining records are fired in the background. Callers blocked by the Block
+// policy are released and their records dropped.
+func (h *AsyncHook) CloseContext(ctx context.Context) error {
+	// Release the callers blocked on a full queue, they hold the read lock
+	h.once.Do(func() { close(h.closing) })
+
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if closer, ok := h.hook.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Stats returns the counters of the hook
+func (h *AsyncHook) Stats() Stats {
+	return Stats{
+		Queued:   len(h.queue),
+		Enqueued: atomic.LoadInt64(&h.enqueued),
+		Fired:    atomic.LoadInt64(&h.fired),
+		Failed:   atomic.LoadInt64(&h.failed),
+		Dropped:  atomic.LoadInt64(&h.dropped),
+	}
+}
+
+// Overflows returns the number of records dropped because the queue was full
+func (h *AsyncHook) Overflows() int64 {
+	return atomic.LoadInt64(&h.dropped)
+}
+
+// Levels returns the levels of the wrapped hook
+func (h *AsyncHook) Levels() []logrus.Level {
+	return h.hook.Levels()
+}
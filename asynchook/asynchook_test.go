@@ -0,0 +1,241 @@
+package asynchook_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/asynchook"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestAsyncHook(t *testing.T) { TestingT(t) }
+
+// Formats the records fired, optionally blocking until released
+type testHook struct {
+	block   chan struct{}
+	err     error
+	mutex   sync.Mutex
+	records []*common.LogRecord
+	closed  bool
+}
+
+func (h *testHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.ErrorLevel, logrus.InfoLevel}
+}
+
+func (h *testHook) Fire(entry *logrus.Entry) error {
+	if h.block != nil {
+		<-h.block
+	}
+	rec := common.NewJSONFormater().Record(entry)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, rec)
+	return h.err
+}
+
+func (h *testHook) Messages() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var result []string
+	for _, rec := range h.records {
+		result = append(result, rec.Message)
+	}
+	return result
+}
+
+func (h *testHook) Close() error {
+	h.closed = true
+	return nil
+}
+
+type AsyncHookTests struct {
+	log *logrus.Logger
+}
+
+var _ = Suite(&AsyncHookTests{})
+
+func (s *AsyncHookTests) SetUpTest(c *C) {
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+}
+
+func (s *AsyncHookTests) TestFire(c *C) {
+	wrapped := &testHook{}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{})
+	c.Assert(hook.Levels(), DeepEquals, wrapped.Levels())
+	s.log.Hooks.Add(hook)
+
+	s.log.WithFields(logrus.Fields{"domain": "example.com"}).Info("one")
+	s.log.Info("two")
+	c.Assert(hook.Flush(context.Background()), IsNil)
+
+	c.Assert(wrapped.Messages(), DeepEquals, []string{"one", "two"})
+	rec := wrapped.records[0]
+	c.Assert(rec.FuncName, Equals, "asynchook_test.(*AsyncHookTests).TestFire")
+	c.Assert(rec.Context["domain"], Equals, "example.com")
+
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(wrapped.closed, Equals, true)
+	c.Assert(hook.Fire(logrus.NewEntry(s.log)), ErrorMatches, "hook is closed")
+
+	stats := hook.Stats()
+	c.Assert(stats.Enqueued, Equals, int64(2))
+	c.Assert(stats.Fired, Equals, int64(2))
+}
+
+func (s *AsyncHookTests) TestDoesNotBlock(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{QueueSize: 2})
+	s.log.Hooks.Add(hook)
+
+	// The first record is being fired, two are queued and two are dropped
+	start := time.Now()
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		s.log.Info(msg)
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+
+	// Flush times out while the hook is blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(hook.Flush(ctx), Equals, context.DeadlineExceeded)
+
+	close(wrapped.block)
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(wrapped.Messages(), DeepEquals, []string{"one", "two", "three"})
+	c.Assert(hook.Stats().Dropped, Equals, int64(2))
+	c.Assert(hook.Overflows(), Equals, int64(2))
+}
+
+func (s *AsyncHookTests) TestDropOldest(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{QueueSize: 2, Overflow: asynchook.DropOldest})
+	s.log.Hooks.Add(hook)
+
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		s.log.Info(msg)
+		time.Sleep(time.Millisecond)
+	}
+	close(wrapped.block)
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(wrapped.Messages(), DeepEquals, []string{"one", "four", "five"})
+	c.Assert(hook.Stats().Dropped, Equals, int64(2))
+}
+
+func (s *AsyncHookTests) TestBlock(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{QueueSize: 1, Overflow: asynchook.Block})
+	s.log.Hooks.Add(hook)
+
+	done := make(chan struct{})
+	go func() {
+		for _, msg := range []string{"one", "two", "three"} {
+			s.log.Info(msg)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		c.Fatal("logging should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(wrapped.block)
+	<-done
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(wrapped.Messages(), DeepEquals, []string{"one", "two", "three"})
+	c.Assert(hook.Stats().Dropped, Equals, int64(0))
+}
+
+func (s *AsyncHookTests) TestCloseWhileBlocked(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	defer close(wrapped.block)
+	hook := asynchook.Wrap(wrapped, asynchook.Options{
+		QueueSize:    1,
+		Overflow:     asynchook.Block,
+		CloseTimeout: 10 * time.Millisecond,
+	})
+
+	// The worker hangs on the first record, the second fills the queue
+	entry := logrus.NewEntry(s.log)
+	c.Assert(hook.Fire(entry), IsNil)
+	c.Assert(hook.Fire(entry), IsNil)
+	errs := make(chan error)
+	go func() { errs <- hook.Fire(entry) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// Close() times out instead of waiting for the blocked caller
+	closed := make(chan error)
+	go func() { closed <- hook.Close() }()
+	select {
+	case err := <-closed:
+		c.Assert(err, Equals, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		c.Fatal("Close() should not wait for callers blocked on a full queue")
+	}
+	c.Assert(<-errs, ErrorMatches, "hook is closed")
+	c.Assert(hook.Stats().Dropped, Equals, int64(1))
+}
+
+func (s *AsyncHookTests) TestWorkers(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{Workers: 3, QueueSize: 1})
+	s.log.Hooks.Add(hook)
+
+	// Three records are fired concurrently and one is queued
+	for i := 0; i < 4; i++ {
+		s.log.Info("record")
+		time.Sleep(time.Millisecond)
+	}
+	close(wrapped.block)
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(hook.Stats().Fired, Equals, int64(4))
+}
+
+func (s *AsyncHookTests) TestErrors(c *C) {
+	var errs []error
+	wrapped := &testHook{err: errors.New("failed")}
+	hook := asynchook.Wrap(wrapped, asynchook.Options{
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	s.log.Hooks.Add(hook)
+
+	s.log.Error("one")
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(errs, HasLen, 1)
+	c.Assert(hook.Stats().Failed, Equals, int64(1))
+}
+
+func (s *AsyncHookTests) TestCloseTimeout(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	defer close(wrapped.block)
+	hook := asynchook.Wrap(wrapped, asynchook.Options{})
+	s.log.Hooks.Add(hook)
+
+	s.log.Info("one")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(hook.CloseContext(ctx), Equals, context.DeadlineExceeded)
+	c.Assert(wrapped.closed, Equals, false)
+}
+
+func (s *AsyncHookTests) TestClose(c *C) {
+	wrapped := &testHook{block: make(chan struct{})}
+	defer close(wrapped.block)
+	hook := asynchook.Wrap(wrapped, asynchook.Options{CloseTimeout: 10 * time.Millisecond})
+	s.log.Hooks.Add(hook)
+
+	// The hook can be closed by wrappers like any other hook
+	var closer interface{ Close() error } = hook
+	s.log.Info("one")
+	c.Assert(closer.Close(), Equals, context.DeadlineExceeded)
+	c.Assert(wrapped.closed, Equals, false)
+}
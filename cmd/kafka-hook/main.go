@@ -7,6 +7,7 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
 	"github.com/mailgun/logrus-hooks/kafkahook"
 	"github.com/sirupsen/logrus"
 	"github.com/thrawn01/args"
@@ -19,6 +20,31 @@ func checkErr(msg string, err error) {
 	}
 }
 
+// Returns the formatter for the encoding, the correlation fields passed with
+// -o are recorded in the correlation fields of the record instead of the
+// context
+func newFormatter(enc encoding.Encoding) (logrus.Formatter, error) {
+	switch enc {
+	case "", encoding.JSON:
+		f := common.NewJSONFormater()
+		f.CorrelationFields = true
+		return f, nil
+	case encoding.MsgPack:
+		f := encoding.NewMsgPackFormatter()
+		f.CorrelationFields = true
+		return f, nil
+	case encoding.CBOR:
+		f := encoding.NewCBORFormatter()
+		f.CorrelationFields = true
+		return f, nil
+	case encoding.Protobuf:
+		f := encoding.NewProtobufFormatter()
+		f.CorrelationFields = true
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown encoding '%s'", enc)
+}
+
 func main() {
 	desc := args.Dedent(`CLI for kafkahook
 
@@ -31,6 +57,10 @@ func main() {
 	   Send a log message with 'other' fields attached
 	   $ kafka-hook "This is a message line" -o "http.request=http://foo/bar" -o "foo=bar"
 
+	   Send a log message with correlation fields, recognized names are trace_id,
+	   span_id, parent_span_id, request_id, session_id, user_id and tenant_id
+	   $ kafka-hook "This is a message line" -o "request_id=5f1c" -o "tenant_id=acme"
+
 	   Send custom JSON to kafkahook
 	   $ echo -e '{"custom":"json"}' | kafkahook -v`)
 
@@ -43,13 +73,21 @@ func main() {
 		Default("localhost:9092").Help("list of endpoints where kafka is listening")
 	parser.AddOption("--topic").Alias("-t").Env("TOPIC").Default("udplog").
 		Help("the topic to publish the log messge too")
+	parser.AddOption("--encoding").Alias("-e").Env("ENCODING").Default("json").
+		Help("the encoding of the log message; json, msgpack, cbor or protobuf")
 
 	// Parser and set global options
 	opts := parser.ParseSimple(nil)
 
+	enc := encoding.Encoding(opts.String("encoding"))
+	formatter, err := newFormatter(enc)
+	checkErr("Formatter Error", err)
+
 	hook, err := kafkahook.New(kafkahook.Config{
 		Endpoints: opts.StringSlice("endpoints"),
 		Topic:     opts.String("topic"),
+		Encoding:  enc,
+		Formatter: formatter,
 	})
 	checkErr("KafkaHook Error", err)
 
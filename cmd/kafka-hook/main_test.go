@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestKafkaHookCLI(t *testing.T) { TestingT(t) }
+
+type KafkaHookCLITests struct{}
+
+var _ = Suite(&KafkaHookCLITests{})
+
+func (s *KafkaHookCLITests) TestCorrelationFields(c *C) {
+	entry := logrus.WithFields(common.ToFields(map[string]string{
+		"request_id": "5f1c",
+		"tenant_id":  "acme",
+	}))
+	entry.Message = "This is a message line"
+
+	for i, enc := range []encoding.Encoding{encoding.JSON, encoding.MsgPack, encoding.CBOR, encoding.Protobuf} {
+		fmt.Printf("Test case #%d\n", i)
+
+		formatter, err := newFormatter(enc)
+		c.Assert(err, IsNil)
+		buf, err := formatter.Format(entry)
+		c.Assert(err, IsNil)
+
+		rec, err := encoding.Decode(enc, buf)
+		c.Assert(err, IsNil)
+		c.Assert(rec.RequestID, Equals, "5f1c")
+		c.Assert(rec.TenantID, Equals, "acme")
+	}
+
+	_, err := newFormatter("xml")
+	c.Assert(err, ErrorMatches, "unknown encoding 'xml'")
+}
@@ -20,6 +20,14 @@ func checkErr(msg string, err error) {
 	}
 }
 
+// Records the correlation fields passed with -o in the correlation fields of
+// the record instead of the context
+func newFormatter() logrus.Formatter {
+	f := common.NewJSONFormater()
+	f.CorrelationFields = true
+	return f
+}
+
 func main() {
 	desc := args.Dedent(`CLI for udplog
 
@@ -32,6 +40,10 @@ func main() {
 	   Send a log message with 'other' fields attached
 	   $ udplog "This is a message line" -o "http.request=http://foo/bar" -o "foo=bar"
 
+	   Send a log message with correlation fields, recognized names are trace_id,
+	   span_id, parent_span_id, request_id, session_id, user_id and tenant_id
+	   $ udplog "This is a message line" -o "request_id=5f1c" -o "tenant_id=acme"
+
 	   Send custom JSON to udplog
 	   $ echo -e '{"custom":"json"}' | udplog -v`)
 
@@ -57,6 +69,7 @@ func main() {
 
 	hook, err := udploghook.New(parts[0], int(port))
 	checkErr("NowLogHook Error", err)
+	hook.SetFormatter(newFormatter())
 
 	if opts.Bool("verbose") {
 		hook.SetDebug(true)
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestUDPLog(t *testing.T) { TestingT(t) }
+
+type UDPLogTests struct{}
+
+var _ = Suite(&UDPLogTests{})
+
+func (s *UDPLogTests) TestCorrelationFields(c *C) {
+	entry := logrus.WithFields(common.ToFields(map[string]string{
+		"request_id": "5f1c",
+		"tenant_id":  "acme",
+		"foo":        "bar",
+	}))
+	entry.Message = "This is a message line"
+
+	buf, err := newFormatter().Format(entry)
+	c.Assert(err, IsNil)
+
+	var rec common.LogRecord
+	c.Assert(rec.UnmarshalJSON(buf), IsNil)
+	c.Assert(rec.RequestID, Equals, "5f1c")
+	c.Assert(rec.TenantID, Equals, "acme")
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{"foo": "bar"})
+}
@@ -0,0 +1,22 @@
+//go:build go1.18
+// +build go1.18
+
+package common
+
+import "runtime/debug"
+
+// Returns the toolchain and vcs settings of the build information
+func buildSettings(info *debug.BuildInfo) map[string]interface{} {
+	settings := map[string]interface{}{"goVersion": info.GoVersion}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			settings["revision"] = s.Value
+		case "vcs.time":
+			settings["time"] = s.Value
+		case "vcs.modified":
+			settings["modified"] = s.Value == "true"
+		}
+	}
+	return settings
+}
@@ -0,0 +1,11 @@
+//go:build !go1.18
+// +build !go1.18
+
+package common
+
+import "runtime/debug"
+
+// The build information of go 1.17 and earlier has no toolchain or vcs settings
+func buildSettings(info *debug.BuildInfo) map[string]interface{} {
+	return nil
+}
@@ -1,11 +1,9 @@
 package common
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"runtime"
 	"strings"
 
@@ -67,27 +65,128 @@ func RequestToMap(req *http.Request) map[string]interface{} {
 	}
 }
 
-// Returns the file, function and line number of the function that called logrus
+// Returns the file, function and line number of the function that called
+// logrus. The frame is empty when not called by logrus, ie by a hook
+// formatting on another goroutine, use CopyEntry() to capture the caller.
 func GetLogrusCaller() *callstack.FrameInfo {
-	var frames [32]uintptr
-
-	// iterate until we find non logrus function
-	length := runtime.Callers(5, frames[:])
-	for idx := 0; idx < (length - 1); idx++ {
-		pc := uintptr(frames[idx]) - 1
-		fn := runtime.FuncForPC(pc)
-		funcName := fn.Name()
-		if strings.Contains(strings.ToLower(funcName), "sirupsen/logrus") {
-			continue
+	frame, ok := logrusCallerFrame()
+	if !ok {
+		return &callstack.FrameInfo{}
+	}
+	return &callstack.FrameInfo{
+		Func:   shortFuncName(frame.Function),
+		File:   frame.File,
+		LineNo: frame.Line,
+	}
+}
+
+func logrusCallerFrame() (runtime.Frame, bool) {
+	var pcs [32]uintptr
+
+	// iterate until we find the first non logrus function after logrus
+	length := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:length])
+	var seenLogrus bool
+	for {
+		frame, more := frames.Next()
+		if isLogrusFunc(frame.Function) {
+			seenLogrus = true
+		} else if seenLogrus {
+			return frame, true
 		}
-		filePath, lineNo := fn.FileLine(pc)
-		return &callstack.FrameInfo{
-			Func:   callstack.FuncName(fn),
-			File:   filePath,
-			LineNo: lineNo,
+		if !more {
+			break
+		}
+	}
+	return runtime.Frame{}, false
+}
+
+// CopyEntry returns a copy of the entry which can be formatted on another
+// goroutine. The fields are copied and, unless the entry already has a
+// caller, the function that called logrus is captured as the caller of the
+// copy. The copy must be made on the goroutine that called logrus, ie in the
+// Fire() of a hook.
+func CopyEntry(entry *logrus.Entry) *logrus.Entry {
+	dup := *entry
+	dup.Buffer = nil
+	dup.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		dup.Data[k] = v
+	}
+	if dup.Caller == nil {
+		if frame, ok := logrusCallerFrame(); ok {
+			dup.Caller = &frame
 		}
 	}
-	return &callstack.FrameInfo{}
+	return &dup
+}
+
+func isLogrusFunc(funcName string) bool {
+	return strings.Contains(strings.ToLower(funcName), "sirupsen/logrus")
+}
+
+// The number of frames GetLogrusStack captures when no limit is given
+const DefaultStackFrames = 32
+
+// Returns the stack of the goroutine that called logrus, starting at the
+// function that called logrus. At most maxFrames are returned. If trim is
+// true the logrus and go runtime frames are omitted from the stack. Returns
+// nil when not called by logrus, ie by a hook formatting on another goroutine.
+func GetLogrusStack(maxFrames int, trim bool) []StackFrame {
+	if maxFrames <= 0 {
+		maxFrames = DefaultStackFrames
+	}
+
+	// Leave room for the logrus and hook frames we skip
+	pcs := make([]uintptr, maxFrames+32)
+	length := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:length])
+
+	var stack []StackFrame
+	var inLogrus, seenLogrus bool
+	for {
+		frame, more := frames.Next()
+		isLogrus := isLogrusFunc(frame.Function)
+		switch {
+		case isLogrus:
+			inLogrus, seenLogrus = true, true
+		case inLogrus:
+			// First frame after logrus is the caller
+			inLogrus = false
+		}
+
+		frameInfo := StackFrame{
+			FuncName: shortFuncName(frame.Function),
+			FileName: frame.File,
+			LineNo:   frame.Line,
+		}
+		switch {
+		case !seenLogrus:
+			// Hook and formatter frames
+		case trim && (isLogrus || strings.HasPrefix(frame.Function, "runtime.")):
+		default:
+			stack = append(stack, frameInfo)
+		}
+
+		if !more || len(stack) == maxFrames {
+			break
+		}
+	}
+
+	if len(stack) > maxFrames {
+		stack = stack[:maxFrames]
+	}
+	return stack
+}
+
+// Returns the function name in the same `<package name>.<function name>`
+// format as callstack.FuncName()
+func shortFuncName(funcPath string) string {
+	idx := strings.LastIndex(funcPath, "/")
+	if idx == -1 {
+		return funcPath
+	}
+	return funcPath[idx+1:]
 }
 
 // Returns true if the key exists in the map
@@ -105,23 +204,18 @@ func ToFields(items map[string]string) logrus.Fields {
 	return result
 }
 
+// GetDockerCID returns the short ID of the container the process runs in,
+// whatever the container runtime
+//
+// Deprecated: use DetectMetadata()
 func GetDockerCID() string {
-	f, err := os.Open("/proc/self/cgroup")
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, "/docker/")
-		if len(parts) != 2 {
-			continue
-		}
+	return shortContainerID(DetectMetadata().ContainerID)
+}
 
-		fullDockerCID := parts[1]
-		return fullDockerCID[:12]
+// Returns the 12 character form of the container ID used by docker
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
 	}
-	return ""
+	return id
 }
@@ -2,9 +2,13 @@ package common_test
 
 import (
 	"bytes"
+	stderrors "errors"
+	"fmt"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/mailgun/holster/v3/errors"
 	"github.com/mailgun/logrus-hooks/common"
 	"github.com/sirupsen/logrus"
 	. "gopkg.in/check.v1"
@@ -132,3 +136,223 @@ func (s *CommonTestSuite) TestNegativeAssertions(c *C) {
 	c.Assert(r.Context["excLineno"], Equals, "1")
 	c.Assert(r.Context["excFileName"], Equals, 10)
 }
+
+func (s *CommonTestSuite) TestCaptureStack(c *C) {
+	var b bytes.Buffer
+	f := common.NewJSONFormater()
+	f.CaptureStack = true
+	f.StackLevel = logrus.ErrorLevel
+
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(f)
+
+	// When
+	log.Error("Error Called")
+
+	// Then
+	var rec common.LogRecord
+	c.Assert(rec.UnmarshalJSON(b.Bytes()), IsNil)
+	c.Assert(len(rec.Stack) > 1, Equals, true)
+	c.Assert(rec.Stack[0].FuncName, Equals, "common_test.(*CommonTestSuite).TestCaptureStack")
+	c.Assert(rec.Stack[0].FuncName, Equals, rec.FuncName)
+	c.Assert(rec.Stack[0].LineNo, Equals, rec.LineNo)
+	for _, frame := range rec.Stack {
+		c.Assert(strings.HasPrefix(frame.FuncName, "runtime."), Equals, false)
+		c.Assert(strings.HasPrefix(frame.FuncName, "logrus."), Equals, false)
+	}
+
+	// Levels less severe than StackLevel do not capture the stack
+	b.Reset()
+	log.Warn("Warn Called")
+	rec = common.LogRecord{}
+	c.Assert(rec.UnmarshalJSON(b.Bytes()), IsNil)
+	c.Assert(rec.Stack, IsNil)
+}
+
+func (s *CommonTestSuite) TestCaptureStackLimits(c *C) {
+	var b bytes.Buffer
+	f := common.NewJSONFormater()
+	f.CaptureStack = true
+	f.StackLevel = logrus.InfoLevel
+	f.StackMaxFrames = 1
+
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(f)
+
+	// When
+	log.Info("Info Called")
+
+	// Then
+	var rec common.LogRecord
+	c.Assert(rec.UnmarshalJSON(b.Bytes()), IsNil)
+	c.Assert(len(rec.Stack), Equals, 1)
+	c.Assert(rec.Stack[0].FuncName, Equals, "common_test.(*CommonTestSuite).TestCaptureStackLimits")
+
+	// Internal frames are kept when asked
+	f.StackMaxFrames = 0
+	f.KeepInternalFrames = true
+	b.Reset()
+	log.Info("Info Called")
+	rec = common.LogRecord{}
+	c.Assert(rec.UnmarshalJSON(b.Bytes()), IsNil)
+	c.Assert(strings.HasPrefix(rec.Stack[0].FuncName, "logrus."), Equals, true)
+	c.Assert(strings.HasPrefix(rec.Stack[len(rec.Stack)-1].FuncName, "runtime."), Equals, true)
+}
+
+func (s *CommonTestSuite) TestCaptureStackDefaults(c *C) {
+	var b bytes.Buffer
+	f := common.NewJSONFormater()
+	f.CaptureStack = true
+
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(f)
+
+	// StackLevel defaults to errors
+	log.Error("Error Called")
+	var rec common.LogRecord
+	c.Assert(rec.UnmarshalJSON(b.Bytes()), IsNil)
+	c.Assert(rec.Stack[0].FuncName, Equals, "common_test.(*CommonTestSuite).TestCaptureStackDefaults")
+
+	// Entries formatted outside of logrus, as by hooks on another goroutine,
+	// have no stack or caller rather than the frames of the hook
+	done := make(chan *common.LogRecord)
+	go func() {
+		entry := logrus.NewEntry(log)
+		entry.Level = logrus.ErrorLevel
+		done <- f.Record(entry)
+	}()
+	out := <-done
+	c.Assert(out.Stack, IsNil)
+	c.Assert(out.FuncName, Equals, "")
+	c.Assert(out.FileName, Equals, "")
+}
+
+func (s *CommonTestSuite) TestErrorChain(c *C) {
+	cause := errors.New("cause")
+	inner := errors.WithContext{"inner": "foo", "shared": "inner"}.Wrap(cause, "inner")
+	middle := fmt.Errorf("middle: %w", inner)
+	outer := errors.WithContext{"outer": "bar", "shared": "outer"}.Wrap(middle, "outer")
+
+	r := common.LogRecord{}
+	r.FromFieldsWithOptions(logrus.Fields{"err": outer}, common.FieldOptions{ErrorChain: true})
+
+	c.Assert(r.ExcValue, Equals, outer.Error())
+	c.Assert(r.ExcType, Equals, "*errors.fundamental")
+	c.Assert(r.Context["inner"], Equals, "foo")
+	c.Assert(r.Context["outer"], Equals, "bar")
+	c.Assert(r.Context["shared"], Equals, "inner")
+	c.Assert(r.FuncName, Equals, "common_test.(*CommonTestSuite).TestErrorChain")
+
+	var types []string
+	for _, layer := range r.ExcChain {
+		types = append(types, layer.Type)
+	}
+	c.Assert(types, DeepEquals, []string{
+		"*errors.withContext", "*fmt.wrapError", "*errors.withContext", "*errors.fundamental"})
+	c.Assert(r.ExcChain[3].Message, Equals, "cause")
+}
+
+func (s *CommonTestSuite) TestErrorChainJoined(c *C) {
+	first := errors.WithContext{"first": 1}.Wrap(errors.New("first"), "wrapped")
+	second := errors.WithContext{"second": 2}.Wrap(errors.New("second"), "wrapped")
+
+	r := common.LogRecord{}
+	r.FromFields(logrus.Fields{"error": stderrors.Join(first, second)})
+
+	c.Assert(r.ExcValue, Equals, "wrapped: first\nwrapped: second")
+	c.Assert(r.ExcType, Equals, "*errors.fundamental")
+	c.Assert(r.Context["first"], Equals, 1)
+	c.Assert(r.Context["second"], Equals, 2)
+	c.Assert(r.ExcChain, IsNil)
+}
+
+func (s *CommonTestSuite) TestMultipleErrors(c *C) {
+	fields := logrus.Fields{
+		"err":          errors.New("err"),
+		"error":        errors.New("error"),
+		"upstream_err": errors.WithContext{"host": "example.com"}.Wrap(errors.New("timeout"), "upstream"),
+	}
+
+	r := common.LogRecord{}
+	r.FromFields(fields)
+
+	c.Assert(r.ExcValue, Equals, "err")
+	c.Assert(r.Context["error"], DeepEquals, map[string]interface{}{
+		"message": "error",
+		"type":    "*errors.fundamental",
+	})
+	c.Assert(r.Context["upstream_err"], DeepEquals, map[string]interface{}{
+		"message": "upstream: timeout",
+		"type":    "*errors.fundamental",
+		"context": map[string]interface{}{"host": "example.com"},
+	})
+
+	// The primary error can be chosen
+	r = common.LogRecord{}
+	r.FromFieldsWithOptions(fields, common.FieldOptions{ErrorKeys: []string{"upstream_err", "error"}})
+
+	c.Assert(r.ExcValue, Equals, "upstream: timeout")
+	c.Assert(r.Context["host"], Equals, "example.com")
+	c.Assert(r.Context["err"].(map[string]interface{})["message"], Equals, "err")
+	c.Assert(r.Context["error"].(map[string]interface{})["message"], Equals, "error")
+
+	// Without err or error the default options record a field with the _err suffix
+	r = common.LogRecord{}
+	r.FromFields(logrus.Fields{
+		"upstream_err": fields["upstream_err"],
+		"db_error":     errors.New("db"),
+		"other":        errors.New("other"),
+	})
+	c.Assert(r.ExcValue, Equals, "db")
+	c.Assert(r.Context["upstream_err"].(map[string]interface{})["message"], Equals, "upstream: timeout")
+	c.Assert(r.Context["other"].(map[string]interface{})["message"], Equals, "other")
+
+	r = common.LogRecord{}
+	r.FromFields(logrus.Fields{"upstream_err": fields["upstream_err"]})
+	c.Assert(r.ExcValue, Equals, "upstream: timeout")
+	c.Assert(r.ExcType, Equals, "*errors.fundamental")
+	c.Assert(r.Context["host"], Equals, "example.com")
+
+	// Keys set in the options are not extended
+	r = common.LogRecord{}
+	r.FromFieldsWithOptions(logrus.Fields{"upstream_err": fields["upstream_err"]},
+		common.FieldOptions{ErrorKeys: []string{"error"}})
+	c.Assert(r.ExcValue, Equals, "")
+}
+
+// Captures a copy of every entry fired
+type copyHook struct {
+	entries []*logrus.Entry
+}
+
+func (h *copyHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *copyHook) Fire(entry *logrus.Entry) error {
+	h.entries = append(h.entries, common.CopyEntry(entry))
+	return nil
+}
+
+func (s *CommonTestSuite) TestCopyEntry(c *C) {
+	hook := &copyHook{}
+	log := logrus.New()
+	log.SetOutput(&bytes.Buffer{})
+	log.AddHook(hook)
+
+	log.WithFields(logrus.Fields{"domain": "example.com"}).Info("Info Called")
+
+	c.Assert(hook.entries, HasLen, 1)
+	entry := hook.entries[0]
+	c.Assert(entry.Data["domain"], Equals, "example.com")
+	c.Assert(entry.Caller, NotNil)
+
+	// The copy is formatted with the captured caller on another goroutine
+	done := make(chan *common.LogRecord)
+	go func() { done <- common.NewJSONFormater().Record(entry) }()
+	rec := <-done
+	c.Assert(rec.FuncName, Equals, "common_test.(*CommonTestSuite).TestCopyEntry")
+	c.Assert(rec.Message, Equals, "Info Called")
+	c.Assert(rec.Context["domain"], Equals, "example.com")
+}
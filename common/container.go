@@ -0,0 +1,171 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Metadata describes the container and the Kubernetes pod the process runs in
+type Metadata struct {
+	// The full ID of the container, empty if not running in a container
+	ContainerID   string
+	ContainerName string
+	PodName       string
+	Namespace     string
+	NodeName      string
+}
+
+// MetadataProvider detects the Metadata of the process
+type MetadataProvider struct {
+	// The cgroup file of the process, defaults to /proc/self/cgroup
+	CgroupPath string
+	// The mountinfo file of the process, searched when the cgroup file does not
+	// hold the container ID as with a private cgroup v2 namespace. Defaults to
+	// /proc/self/mountinfo
+	MountInfoPath string
+	// Directory of a downward API volume with `pod_name`, `pod_namespace`,
+	// `node_name` and `container_name` files, defaults to /etc/podinfo
+	PodInfoDir string
+	// The namespace file of the service account, defaults to
+	// /var/run/secrets/kubernetes.io/serviceaccount/namespace
+	NamespacePath string
+	// Reads environment variables, defaults to os.Getenv
+	Getenv func(key string) string
+}
+
+// The environment variables the downward API is expected to set
+const (
+	EnvPodName       = "POD_NAME"
+	EnvPodNamespace  = "POD_NAMESPACE"
+	EnvNodeName      = "NODE_NAME"
+	EnvContainerName = "CONTAINER_NAME"
+)
+
+// DetectMetadata returns the Metadata of the process read from the default locations
+func DetectMetadata() Metadata {
+	return MetadataProvider{}.Detect()
+}
+
+// Detect returns the Metadata of the process. Kubernetes fields are read from
+// the downward API environment variables first, then from the downward API
+// volume. Outside of a container every field is empty.
+func (p MetadataProvider) Detect() Metadata {
+	if p.CgroupPath == "" {
+		p.CgroupPath = "/proc/self/cgroup"
+	}
+	if p.MountInfoPath == "" {
+		p.MountInfoPath = "/proc/self/mountinfo"
+	}
+	if p.PodInfoDir == "" {
+		p.PodInfoDir = "/etc/podinfo"
+	}
+	if p.NamespacePath == "" {
+		p.NamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	}
+	if p.Getenv == nil {
+		p.Getenv = os.Getenv
+	}
+
+	var md Metadata
+	if f, err := os.Open(p.CgroupPath); err == nil {
+		md.ContainerID = ContainerIDFromCgroup(f)
+		f.Close()
+	}
+	if md.ContainerID == "" {
+		if f, err := os.Open(p.MountInfoPath); err == nil {
+			md.ContainerID = ContainerIDFromMountInfo(f)
+			f.Close()
+		}
+	}
+
+	md.PodName = p.lookup(EnvPodName, "pod_name")
+	md.Namespace = p.lookup(EnvPodNamespace, "pod_namespace")
+	md.NodeName = p.lookup(EnvNodeName, "node_name")
+	md.ContainerName = p.lookup(EnvContainerName, "container_name")
+	if md.Namespace == "" {
+		md.Namespace = readTrimmed(p.NamespacePath)
+	}
+	return md
+}
+
+// Returns the value of the environment variable or the downward API file
+func (p MetadataProvider) lookup(env, file string) string {
+	if v := p.Getenv(env); v != "" {
+		return v
+	}
+	return readTrimmed(filepath.Join(p.PodInfoDir, file))
+}
+
+func readTrimmed(path string) string {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// ContainerIDFromCgroup returns the ID of the container in a cgroup file as
+// found in /proc/self/cgroup. Both cgroup v1 and v2 are supported, and the
+// path layouts of docker, containerd, cri-o and podman with or without the
+// systemd cgroup driver, ie
+//
+//	12:cpu,cpuacct:/docker/<id>
+//	0::/system.slice/docker-<id>.scope
+//	0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//	11:memory:/kubepods/besteffort/pod<uid>/<id>
+//	0::/kubepods.slice/kubepods-pod<uid>.slice/crio-<id>.scope
+//	0::/machine.slice/libpod-<id>.scope/container
+//
+// Returns an empty string if there is no container ID, ie with a private
+// cgroup v2 namespace where the file only holds `0::/`.
+func ContainerIDFromCgroup(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		// The container is the last ID of the path, the pod sandbox may come before it
+		if ids := containerIDPattern.FindAllString(parts[2], -1); len(ids) != 0 {
+			return ids[len(ids)-1]
+		}
+	}
+	return ""
+}
+
+var mountContainerIDPattern = regexp.MustCompile(`/(?:docker/containers|overlay-containers)/([0-9a-f]{64})/`)
+
+// The mount points of the files the runtimes bind mount into the container
+var containerMountPoints = map[string]bool{
+	"/etc/hostname":    true,
+	"/etc/hosts":       true,
+	"/etc/resolv.conf": true,
+}
+
+// ContainerIDFromMountInfo returns the ID of the container in a mountinfo
+// file as found in /proc/self/mountinfo. Docker, cri-o and podman bind mount
+// the hostname, hosts and resolv.conf files of the container from a directory
+// named after its ID. Only the root of these mounts is checked, as a process
+// on the host can see the mounts of other containers.
+func ContainerIDFromMountInfo(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// The 4th field is the root of the mount, the 5th the mount point
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !containerMountPoints[fields[4]] {
+			continue
+		}
+		if m := mountContainerIDPattern.FindStringSubmatch(fields[3]); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
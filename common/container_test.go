@@ -0,0 +1,131 @@
+package common_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+const containerID = "c6ba2a4a9e6dc93a5b9c3ec1f3dbf1b9b86e1d1a0f0f4c1c8e3d3f1b8e7b6a5a"
+
+func (s *CommonTestSuite) TestContainerIDFromCgroup(c *C) {
+	for i, tc := range []struct {
+		file     string
+		expected string
+	}{
+		0:  {file: "docker-v1", expected: containerID},
+		1:  {file: "docker-systemd-v2", expected: containerID},
+		2:  {file: "containerd-k8s-v1", expected: containerID},
+		3:  {file: "containerd-k8s-v2", expected: containerID},
+		4:  {file: "crio-v1", expected: containerID},
+		5:  {file: "crio-conmon-v2", expected: containerID},
+		6:  {file: "podman-v2", expected: containerID},
+		7:  {file: "podman-rootless-v2", expected: containerID},
+		8:  {file: "host-v1", expected: ""},
+		9:  {file: "host-v2", expected: ""},
+		10: {file: "private-v2", expected: ""},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+		f, err := os.Open(filepath.Join("testdata", "cgroup", tc.file))
+		c.Assert(err, IsNil)
+		c.Assert(common.ContainerIDFromCgroup(f), Equals, tc.expected)
+		f.Close()
+	}
+}
+
+func (s *CommonTestSuite) TestContainerIDFromMountInfo(c *C) {
+	for i, tc := range []struct {
+		file     string
+		expected string
+	}{
+		0: {file: "mountinfo-docker", expected: containerID},
+		1: {file: "mountinfo-podman", expected: containerID},
+		2: {file: "mountinfo-host", expected: ""},
+		// The shm mount of another container seen from the host
+		3: {file: "mountinfo-host-shm", expected: ""},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+		f, err := os.Open(filepath.Join("testdata", "cgroup", tc.file))
+		c.Assert(err, IsNil)
+		c.Assert(common.ContainerIDFromMountInfo(f), Equals, tc.expected)
+		f.Close()
+	}
+}
+
+func (s *CommonTestSuite) TestMetadataProvider(c *C) {
+	dir, err := ioutil.TempDir("", "podinfo")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "pod_name"), []byte("api-7d4b9c-x2x8q\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "node_name"), []byte("node-1\n"), 0644), IsNil)
+	namespace := filepath.Join(dir, "namespace")
+	c.Assert(ioutil.WriteFile(namespace, []byte("prod"), 0644), IsNil)
+
+	env := map[string]string{}
+	p := common.MetadataProvider{
+		CgroupPath:    filepath.Join("testdata", "cgroup", "private-v2"),
+		MountInfoPath: filepath.Join("testdata", "cgroup", "mountinfo-docker"),
+		PodInfoDir:    dir,
+		NamespacePath: namespace,
+		Getenv:        func(key string) string { return env[key] },
+	}
+
+	// The container ID is found in mountinfo, the Kubernetes fields in the files
+	c.Assert(p.Detect(), DeepEquals, common.Metadata{
+		ContainerID: containerID,
+		PodName:     "api-7d4b9c-x2x8q",
+		Namespace:   "prod",
+		NodeName:    "node-1",
+	})
+
+	// The environment has precedence over the files
+	env[common.EnvPodName] = "api-5c8f7d-k9k2w"
+	env[common.EnvPodNamespace] = "staging"
+	env[common.EnvContainerName] = "api"
+	p.CgroupPath = filepath.Join("testdata", "cgroup", "containerd-k8s-v2")
+	p.MountInfoPath = filepath.Join("testdata", "cgroup", "mountinfo-host")
+	c.Assert(p.Detect(), DeepEquals, common.Metadata{
+		ContainerID:   containerID,
+		ContainerName: "api",
+		PodName:       "api-5c8f7d-k9k2w",
+		Namespace:     "staging",
+		NodeName:      "node-1",
+	})
+
+	// Outside of a container
+	c.Assert(common.MetadataProvider{
+		CgroupPath:    filepath.Join("testdata", "cgroup", "host-v2"),
+		MountInfoPath: filepath.Join("testdata", "cgroup", "mountinfo-host"),
+		PodInfoDir:    filepath.Join(dir, "missing"),
+		NamespacePath: filepath.Join(dir, "missing"),
+		Getenv:        func(string) string { return "" },
+	}.Detect(), DeepEquals, common.Metadata{})
+}
+
+func (s *CommonTestSuite) TestRecordMetadata(c *C) {
+	f := common.NewJSONFormater()
+	f.SetMetadata(common.Metadata{
+		ContainerID:   containerID,
+		ContainerName: "api",
+		PodName:       "api-7d4b9c-x2x8q",
+		Namespace:     "prod",
+		NodeName:      "node-1",
+	})
+
+	rec := f.Record(logrus.NewEntry(logrus.New()))
+	c.Assert(rec.CID, Equals, containerID[:12])
+	c.Assert(rec.ContainerName, Equals, "api")
+	c.Assert(rec.PodName, Equals, "api-7d4b9c-x2x8q")
+	c.Assert(rec.PodNamespace, Equals, "prod")
+	c.Assert(rec.NodeName, Equals, "node-1")
+
+	buf, err := f.Format(logrus.NewEntry(logrus.New()))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Matches, `.*"cid":"c6ba2a4a9e6d",.*"podName":"api-7d4b9c-x2x8q",`+
+		`"podNamespace":"prod","nodeName":"node-1","containerName":"api".*\n`)
+}
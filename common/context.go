@@ -0,0 +1,197 @@
+package common
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContextExtractor copies values from the context of an entry, as set by
+// logrus.WithContext(), into the record. Extractors run after the fields of
+// the entry are recorded and should not replace values set by the fields.
+type ContextExtractor func(ctx context.Context, rec *LogRecord)
+
+// DefaultContextExtractors are the extractors of the formatters returned by NewJSONFormater()
+var DefaultContextExtractors = []ContextExtractor{CorrelationExtractor, TraceParentExtractor}
+
+// Correlation holds the IDs which correlate the records of a request across services
+type Correlation struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	RequestID    string
+	SessionID    string
+	UserID       string
+	TenantID     string
+}
+
+type correlationKey struct{}
+
+// ContextWithCorrelation returns a context which holds the correlation IDs
+func ContextWithCorrelation(ctx context.Context, c Correlation) context.Context {
+	return context.WithValue(ctx, correlationKey{}, c)
+}
+
+// CorrelationFromContext returns the correlation IDs set by ContextWithCorrelation()
+func CorrelationFromContext(ctx context.Context) (Correlation, bool) {
+	c, ok := ctx.Value(correlationKey{}).(Correlation)
+	return c, ok
+}
+
+// CorrelationExtractor records the IDs set by ContextWithCorrelation() in the
+// correlation fields of the record which are empty
+func CorrelationExtractor(ctx context.Context, rec *LogRecord) {
+	c, ok := CorrelationFromContext(ctx)
+	if !ok {
+		return
+	}
+	for _, f := range []struct {
+		dest  *string
+		value string
+	}{
+		{&rec.TID, c.TraceID},
+		{&rec.SpanID, c.SpanID},
+		{&rec.ParentSpanID, c.ParentSpanID},
+		{&rec.RequestID, c.RequestID},
+		{&rec.SessionID, c.SessionID},
+		{&rec.UserID, c.UserID},
+		{&rec.TenantID, c.TenantID},
+	} {
+		if *f.dest == "" {
+			*f.dest = f.value
+		}
+	}
+}
+
+type traceParentKey struct{}
+
+// ContextWithTraceParent returns a context which holds a W3C traceparent,
+// ie the `traceparent` header of the request being handled
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceParent)
+}
+
+// TraceParentFromContext returns the traceparent set by ContextWithTraceParent()
+func TraceParentFromContext(ctx context.Context) (string, bool) {
+	traceParent, ok := ctx.Value(traceParentKey{}).(string)
+	return traceParent, ok
+}
+
+// TraceParentExtractor records the trace ID, span ID and trace flags of the
+// traceparent string set by ContextWithTraceParent() in `tid`, `spanId` and
+// `traceFlags`. Invalid traceparents are ignored. It does not read the spans
+// of a tracing library, use SpanContextExtractor() for them.
+func TraceParentExtractor(ctx context.Context, rec *LogRecord) {
+	traceParent, ok := TraceParentFromContext(ctx)
+	if !ok || rec.TID != "" {
+		return
+	}
+	traceID, spanID, flags, err := ParseTraceParent(traceParent)
+	if err != nil {
+		return
+	}
+	rec.TID, rec.SpanID, rec.TraceFlags = traceID, spanID, flags
+}
+
+// SpanContextFunc returns the trace ID, span ID and trace flags of the span of
+// the context, ok is false if the context has no valid span
+type SpanContextFunc func(ctx context.Context) (traceID, spanID, flags string, ok bool)
+
+// SpanContextExtractor records the trace ID, span ID and trace flags of the
+// span returned by the func in `tid`, `spanId` and `traceFlags`. The func
+// adapts the span context of a tracing library, ie for OpenTelemetry
+//
+//	func(ctx context.Context) (string, string, string, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return sc.TraceID().String(), sc.SpanID().String(), sc.TraceFlags().String(), sc.IsValid()
+//	}
+func SpanContextExtractor(fn SpanContextFunc) ContextExtractor {
+	return func(ctx context.Context, rec *LogRecord) {
+		if rec.TID != "" {
+			return
+		}
+		traceID, spanID, flags, ok := fn(ctx)
+		if !ok {
+			return
+		}
+		rec.TID, rec.SpanID, rec.TraceFlags = traceID, spanID, flags
+	}
+}
+
+// ParseTraceParent returns the trace ID, parent span ID and trace flags of a
+// W3C traceparent as described by https://www.w3.org/TR/trace-context/#traceparent-header
+func ParseTraceParent(traceParent string) (traceID, spanID, flags string, err error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return "", "", "", errors.Errorf("invalid traceparent '%s'", traceParent)
+	}
+	version := parts[0]
+	traceID, spanID, flags = parts[1], parts[2], parts[3]
+	switch {
+	case !isLowerHex(version, 2) || version == "ff":
+		return "", "", "", errors.Errorf("invalid traceparent version '%s'", version)
+	case version == "00" && len(parts) != 4:
+		return "", "", "", errors.Errorf("invalid traceparent '%s'", traceParent)
+	case !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32):
+		return "", "", "", errors.Errorf("invalid trace id '%s'", traceID)
+	case !isLowerHex(spanID, 16) || spanID == strings.Repeat("0", 16):
+		return "", "", "", errors.Errorf("invalid span id '%s'", spanID)
+	case !isLowerHex(flags, 2):
+		return "", "", "", errors.Errorf("invalid trace flags '%s'", flags)
+	}
+	return traceID, spanID, flags, nil
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextValueExtractor records the value stored in the context under the key
+// in the `context` of the record under the name. Dotted names are expanded
+// like the names of logrus fields.
+func ContextValueExtractor(key interface{}, name string) ContextExtractor {
+	return func(ctx context.Context, rec *LogRecord) {
+		if v := ctx.Value(key); v != nil {
+			AddContext(rec, name, v)
+		}
+	}
+}
+
+// AddContext records the value in the `context` of the record under the name,
+// unless the context already has a value for the name as set by the fields of
+// the entry. Dotted names are expanded like the names of logrus fields.
+func AddContext(rec *LogRecord, name string, v interface{}) {
+	if rec.Context == nil {
+		rec.Context = make(map[string]interface{})
+	}
+	if hasNested(name, rec.Context) {
+		return
+	}
+	ExpandNested(name, v, rec.Context)
+}
+
+// Returns true if ExpandNested() would replace a value for the key
+func hasNested(key string, m map[string]interface{}) bool {
+	parts := strings.SplitN(key, ".", 2)
+	v, ok := m[parts[0]]
+	if !ok {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	nested, ok := v.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	return hasNested(parts[1], nested)
+}
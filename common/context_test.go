@@ -0,0 +1,262 @@
+package common_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func (s *CommonTestSuite) TestParseTraceParent(c *C) {
+	for i, tc := range []struct {
+		traceParent string
+		traceID     string
+		spanID      string
+		flags       string
+		err         string
+	}{
+		0: {
+			traceParent: traceParent,
+			traceID:     "0af7651916cd43dd8448eb211c80319c",
+			spanID:      "b7ad6b7169203331",
+			flags:       "01",
+		},
+		1: {
+			// Future versions may add fields
+			traceParent: "cc-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00-what-the-future-holds",
+			traceID:     "0af7651916cd43dd8448eb211c80319c",
+			spanID:      "b7ad6b7169203331",
+			flags:       "00",
+		},
+		2: {traceParent: "", err: "invalid traceparent ''"},
+		3: {traceParent: traceParent + "-00", err: "invalid traceparent '.*'"},
+		4: {traceParent: "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", err: "invalid traceparent version 'ff'"},
+		5: {traceParent: "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", err: "invalid trace id '0AF7651916CD43DD8448EB211C80319C'"},
+		6: {traceParent: "00-00000000000000000000000000000000-b7ad6b7169203331-01", err: "invalid trace id '0+'"},
+		7: {traceParent: "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", err: "invalid span id '0+'"},
+		8: {traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01", err: "invalid span id 'b7ad6b71692033'"},
+		9: {traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1", err: "invalid trace flags '1'"},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+		traceID, spanID, flags, err := common.ParseTraceParent(tc.traceParent)
+		if tc.err != "" {
+			c.Assert(err, ErrorMatches, tc.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(traceID, Equals, tc.traceID)
+		c.Assert(spanID, Equals, tc.spanID)
+		c.Assert(flags, Equals, tc.flags)
+	}
+}
+
+type jobIDKey struct{}
+
+func (s *CommonTestSuite) TestContextExtractors(c *C) {
+	f := common.NewJSONFormater()
+	f.ContextExtractors = []common.ContextExtractor{
+		common.TraceParentExtractor,
+		common.ContextValueExtractor(jobIDKey{}, "job_id"),
+		common.ContextValueExtractor("tenant", "tenant.id"),
+	}
+
+	ctx := common.ContextWithTraceParent(context.Background(), traceParent)
+	ctx = context.WithValue(ctx, jobIDKey{}, "job-1")
+	ctx = context.WithValue(ctx, "tenant", 42)
+
+	log := logrus.New()
+	rec := f.Record(log.WithContext(ctx).WithField("foo", "bar"))
+	c.Assert(rec.TID, Equals, "0af7651916cd43dd8448eb211c80319c")
+	c.Assert(rec.SpanID, Equals, "b7ad6b7169203331")
+	c.Assert(rec.TraceFlags, Equals, "01")
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{
+		"foo":    "bar",
+		"job_id": "job-1",
+		"tenant": map[string]interface{}{"id": 42},
+	})
+
+	// Fields have precedence over the context
+	rec = f.Record(log.WithContext(ctx).WithFields(logrus.Fields{
+		"tid":       "foo",
+		"job_id":    "job-2",
+		"tenant.id": 43,
+	}))
+	c.Assert(rec.TID, Equals, "foo")
+	c.Assert(rec.SpanID, Equals, "")
+	c.Assert(rec.Context["job_id"], Equals, "job-2")
+	c.Assert(rec.Context["tenant"], DeepEquals, map[string]interface{}{"id": 43})
+
+	// Entries without a context or without the values are left alone
+	rec = f.Record(log.WithField("foo", "bar"))
+	c.Assert(rec.TID, Equals, "")
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{"foo": "bar"})
+	rec = f.Record(log.WithContext(context.Background()))
+	c.Assert(rec.TID, Equals, "")
+	c.Assert(rec.Context, IsNil)
+
+	// The new fields are marshalled
+	buf, err := f.Format(log.WithContext(ctx))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Matches, `.*"tid":"0af7651916cd43dd8448eb211c80319c","spanId":"b7ad6b7169203331","traceFlags":"01".*\n`)
+}
+
+func (s *CommonTestSuite) TestCorrelationFields(c *C) {
+	for i, tc := range []struct {
+		fields   logrus.Fields
+		opts     common.FieldOptions
+		expected common.LogRecord
+		context  map[string]interface{}
+	}{
+		0: {
+			fields: logrus.Fields{
+				"trace_id":       "trace-1",
+				"span_id":        "span-1",
+				"trace_flags":    "01",
+				"parent_span_id": "span-0",
+				"request_id":     "req-1",
+				"session_id":     "sess-1",
+				"user_id":        "user-1",
+				"tenant_id":      "acme",
+			},
+			opts: common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{
+				TID: "trace-1", SpanID: "span-1", TraceFlags: "01", ParentSpanID: "span-0", RequestID: "req-1",
+				SessionID: "sess-1", UserID: "user-1", TenantID: "acme",
+			},
+			context: map[string]interface{}{},
+		},
+		1: {
+			fields: logrus.Fields{
+				"traceId":      "trace-1",
+				"spanId":       "span-1",
+				"parentSpanId": "span-0",
+				"requestId":    "req-1",
+				"sessionId":    "sess-1",
+				"userId":       "user-1",
+				"tenantId":     "acme",
+			},
+			opts: common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{
+				TID: "trace-1", SpanID: "span-1", ParentSpanID: "span-0", RequestID: "req-1",
+				SessionID: "sess-1", UserID: "user-1", TenantID: "acme",
+			},
+			context: map[string]interface{}{},
+		},
+		2: {
+			// Values other than strings are recorded in the context
+			fields:   logrus.Fields{"user_id": 42, "request_id": "req-1"},
+			opts:     common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{RequestID: "req-1"},
+			context:  map[string]interface{}{"user_id": 42},
+		},
+		3: {
+			// Only `tid` is recorded by default, the other names stay in the context
+			fields:   logrus.Fields{"tid": "trace-1", "request_id": "req-1", "userId": "user-1", "traceFlags": "01"},
+			expected: common.LogRecord{TID: "trace-1"},
+			context:  map[string]interface{}{"request_id": "req-1", "userId": "user-1", "traceFlags": "01"},
+		},
+		4: {
+			// `tid` has precedence over `traceId` which has precedence over `trace_id`
+			fields:   logrus.Fields{"tid": "trace-1", "traceId": "trace-2", "trace_id": "trace-3"},
+			opts:     common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{TID: "trace-1"},
+			context:  map[string]interface{}{"traceId": "trace-2", "trace_id": "trace-3"},
+		},
+		5: {
+			fields:   logrus.Fields{"traceId": "trace-2", "trace_id": "trace-3", "request_id": "req-1", "requestId": "req-2"},
+			opts:     common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{TID: "trace-2", RequestID: "req-2"},
+			context:  map[string]interface{}{"trace_id": "trace-3", "request_id": "req-1"},
+		},
+		6: {
+			fields:   logrus.Fields{"traceId": "trace-2", "tid": "trace-1"},
+			opts:     common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{TID: "trace-1"},
+			context:  map[string]interface{}{"traceId": "trace-2"},
+		},
+		7: {
+			// A name with a value other than a string does not take precedence
+			fields:   logrus.Fields{"tid": 10, "trace_id": "trace-3"},
+			opts:     common.FieldOptions{CorrelationFields: true},
+			expected: common.LogRecord{TID: "trace-3"},
+			context:  map[string]interface{}{"tid": 10},
+		},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+		var rec common.LogRecord
+		rec.FromFieldsWithOptions(tc.fields, tc.opts)
+		c.Assert(rec.Context, DeepEquals, tc.context)
+		rec.Context = nil
+		c.Assert(rec, DeepEquals, tc.expected)
+	}
+}
+
+func (s *CommonTestSuite) TestCorrelationExtractor(c *C) {
+	f := common.NewJSONFormater()
+	f.CorrelationFields = true
+	ctx := common.ContextWithCorrelation(context.Background(), common.Correlation{
+		TraceID:      "trace-1",
+		SpanID:       "span-1",
+		ParentSpanID: "span-0",
+		RequestID:    "req-1",
+		SessionID:    "sess-1",
+		UserID:       "user-1",
+		TenantID:     "acme",
+	})
+
+	// The correlation extractor is a default extractor, fields have precedence
+	log := logrus.New()
+	rec := f.Record(log.WithContext(ctx).WithField("request_id", "req-2"))
+	c.Assert(rec.TID, Equals, "trace-1")
+	c.Assert(rec.SpanID, Equals, "span-1")
+	c.Assert(rec.ParentSpanID, Equals, "span-0")
+	c.Assert(rec.RequestID, Equals, "req-2")
+	c.Assert(rec.SessionID, Equals, "sess-1")
+	c.Assert(rec.UserID, Equals, "user-1")
+	c.Assert(rec.TenantID, Equals, "acme")
+
+	buf, err := f.Format(log.WithContext(ctx))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Matches, `.*"tid":"trace-1","spanId":"span-1","parentSpanId":"span-0",`+
+		`"requestId":"req-1","sessionId":"sess-1","userId":"user-1","tenantId":"acme".*\n`)
+
+	// The correlation of the context has precedence over the traceparent
+	ctx = common.ContextWithTraceParent(ctx, traceParent)
+	rec = f.Record(log.WithContext(ctx))
+	c.Assert(rec.TID, Equals, "trace-1")
+	c.Assert(rec.TraceFlags, Equals, "")
+}
+
+type spanKey struct{}
+
+func (s *CommonTestSuite) TestSpanContextExtractor(c *C) {
+	f := common.NewJSONFormater()
+	f.ContextExtractors = []common.ContextExtractor{
+		common.SpanContextExtractor(func(ctx context.Context) (string, string, string, bool) {
+			span, ok := ctx.Value(spanKey{}).([3]string)
+			return span[0], span[1], span[2], ok
+		}),
+		common.TraceParentExtractor,
+	}
+	ctx := context.WithValue(context.Background(), spanKey{}, [3]string{"trace-1", "span-1", "01"})
+
+	// The span has precedence over the traceparent
+	log := logrus.New()
+	rec := f.Record(log.WithContext(common.ContextWithTraceParent(ctx, traceParent)))
+	c.Assert(rec.TID, Equals, "trace-1")
+	c.Assert(rec.SpanID, Equals, "span-1")
+	c.Assert(rec.TraceFlags, Equals, "01")
+
+	// Fields have precedence over the span
+	rec = f.Record(log.WithContext(ctx).WithField("tid", "foo"))
+	c.Assert(rec.TID, Equals, "foo")
+	c.Assert(rec.SpanID, Equals, "")
+
+	// Contexts without a span are left alone
+	rec = f.Record(log.WithContext(context.Background()))
+	c.Assert(rec.TID, Equals, "")
+}
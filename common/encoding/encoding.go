@@ -0,0 +1,507 @@
+// Package encoding encodes LogRecords in binary wire formats. The codecs live
+// outside of package common so only the importers of this package depend on them.
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v4"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Encoding names a wire format a LogRecord can be encoded in
+type Encoding string
+
+const (
+	JSON     Encoding = "json"
+	MsgPack  Encoding = "msgpack"
+	CBOR     Encoding = "cbor"
+	Protobuf Encoding = "protobuf"
+)
+
+// Returns a formatter for the encoding, an empty encoding returns the
+// common.DefaultFormatter
+func NewFormatter(encoding Encoding) (logrus.Formatter, error) {
+	switch encoding {
+	case "", JSON:
+		return common.DefaultFormatter, nil
+	case MsgPack:
+		return NewMsgPackFormatter(), nil
+	case CBOR:
+		return NewCBORFormatter(), nil
+	case Protobuf:
+		return NewProtobufFormatter(), nil
+	}
+	return nil, fmt.Errorf("unknown encoding '%s'", encoding)
+}
+
+// Decodes a record encoded by the formatter for the encoding
+func Decode(encoding Encoding, buf []byte) (*common.LogRecord, error) {
+	switch encoding {
+	case "", JSON:
+		var rec common.LogRecord
+		if err := rec.UnmarshalJSON(buf); err != nil {
+			return nil, errors.Wrap(err, "while decoding json")
+		}
+		return &rec, nil
+	case MsgPack:
+		return DecodeMsgPack(buf)
+	case CBOR:
+		return DecodeCBOR(buf)
+	case Protobuf:
+		return DecodeProtobuf(buf)
+	}
+	return nil, fmt.Errorf("unknown encoding '%s'", encoding)
+}
+
+// MsgPackFormatter encodes the LogRecord as MessagePack using the same
+// field names as the JSON record. The embedded JSONFormater extracts the
+// LogRecord and holds its options.
+type MsgPackFormatter struct {
+	common.JSONFormater
+}
+
+func NewMsgPackFormatter() *MsgPackFormatter {
+	return &MsgPackFormatter{JSONFormater: *common.NewJSONFormater()}
+}
+
+func (f *MsgPackFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return EncodeMsgPack(f.Record(entry))
+}
+
+// The timestamp of the record shadows the seconds since the epoch of the
+// embedded record, it must be declared first to shadow it
+type msgpackRecord struct {
+	Timestamp msgpackTimestamp `json:"timestamp,omitempty"`
+	*common.LogRecord
+}
+
+// The timestamp is encoded using the msgpack timestamp extension type
+type msgpackTimestamp common.Number
+
+func (ts msgpackTimestamp) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeTime(common.Number(ts).Time())
+}
+
+func (ts *msgpackTimestamp) DecodeMsgpack(dec *msgpack.Decoder) error {
+	t, err := dec.DecodeTime()
+	if err != nil {
+		return err
+	}
+	*ts = msgpackTimestamp(common.TimeToNumber(t))
+	return nil
+}
+
+func EncodeMsgPack(rec *common.LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	mr := msgpackRecord{Timestamp: msgpackTimestamp(rec.Timestamp), LogRecord: rec}
+	if err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(&mr); err != nil {
+		return nil, errors.Wrap(err, "while encoding msgpack")
+	}
+	return buf.Bytes(), nil
+}
+
+func DecodeMsgPack(buf []byte) (*common.LogRecord, error) {
+	var rec common.LogRecord
+	mr := msgpackRecord{LogRecord: &rec}
+	if err := msgpack.NewDecoder(bytes.NewReader(buf)).UseJSONTag(true).Decode(&mr); err != nil {
+		return nil, errors.Wrap(err, "while decoding msgpack")
+	}
+	rec.Timestamp = common.Number(mr.Timestamp)
+	return &rec, nil
+}
+
+// CBORFormatter encodes the LogRecord as CBOR using the same field names as
+// the JSON record. The embedded JSONFormater extracts the LogRecord and holds
+// its options.
+type CBORFormatter struct {
+	common.JSONFormater
+}
+
+func NewCBORFormatter() *CBORFormatter {
+	return &CBORFormatter{JSONFormater: *common.NewJSONFormater()}
+}
+
+func (f *CBORFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return EncodeCBOR(f.Record(entry))
+}
+
+// Timestamps are encoded as epoch time with tag 1 and microsecond precision
+var cborTimeMode, _ = cbor.EncOptions{
+	Time:    cbor.TimeUnixDynamic,
+	TimeTag: cbor.EncTagRequired,
+}.EncMode()
+
+// The timestamp of the record shadows the seconds since the epoch of the
+// embedded record, CBOR only tags time.Time as an epoch time
+type cborRecord struct {
+	*common.LogRecord
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func EncodeCBOR(rec *common.LogRecord) ([]byte, error) {
+	buf, err := cborTimeMode.Marshal(cborRecord{LogRecord: rec, Timestamp: rec.Timestamp.Time()})
+	if err != nil {
+		return nil, errors.Wrap(err, "while encoding cbor")
+	}
+	return buf, nil
+}
+
+func DecodeCBOR(buf []byte) (*common.LogRecord, error) {
+	var rec common.LogRecord
+	shadow := cborRecord{LogRecord: &rec}
+	if err := cbor.Unmarshal(buf, &shadow); err != nil {
+		return nil, errors.Wrap(err, "while decoding cbor")
+	}
+	rec.Timestamp = common.TimeToNumber(shadow.Timestamp.Round(time.Microsecond))
+	// CBOR maps decode as map[interface{}]interface{}
+	for k, v := range rec.Context {
+		rec.Context[k] = stringKeys(v)
+	}
+	return &rec, nil
+}
+
+// Converts nested map[interface{}]interface{} values to map[string]interface{}
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for mk, mv := range v {
+			result[fmt.Sprint(mk)] = stringKeys(mv)
+		}
+		return result
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+	}
+	return value
+}
+
+// ProtobufFormatter encodes the LogRecord using the protobuf schema published
+// in logrecord.proto. The embedded JSONFormater extracts the LogRecord and
+// holds its options.
+type ProtobufFormatter struct {
+	common.JSONFormater
+}
+
+func NewProtobufFormatter() *ProtobufFormatter {
+	return &ProtobufFormatter{JSONFormater: *common.NewJSONFormater()}
+}
+
+func (f *ProtobufFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return EncodeProtobuf(f.Record(entry))
+}
+
+// Field numbers of the LogRecord message in logrecord.proto
+const (
+	pbContext       protowire.Number = 1
+	pbCategory      protowire.Number = 2
+	pbAppName       protowire.Number = 3
+	pbHostName      protowire.Number = 4
+	pbLogLevel      protowire.Number = 5
+	pbFileName      protowire.Number = 6
+	pbFuncName      protowire.Number = 7
+	pbLineNo        protowire.Number = 8
+	pbMessage       protowire.Number = 9
+	pbTimestamp     protowire.Number = 10
+	pbCID           protowire.Number = 11
+	pbPID           protowire.Number = 12
+	pbTID           protowire.Number = 13
+	pbExcType       protowire.Number = 14
+	pbExcText       protowire.Number = 15
+	pbExcValue      protowire.Number = 16
+	pbExcChain      protowire.Number = 17
+	pbStack         protowire.Number = 18
+	pbSpanID        protowire.Number = 19
+	pbTraceFlags    protowire.Number = 20
+	pbParentSpanID  protowire.Number = 21
+	pbRequestID     protowire.Number = 22
+	pbSessionID     protowire.Number = 23
+	pbUserID        protowire.Number = 24
+	pbTenantID      protowire.Number = 25
+	pbPodName       protowire.Number = 26
+	pbPodNamespace  protowire.Number = 27
+	pbNodeName      protowire.Number = 28
+	pbContainerName protowire.Number = 29
+	pbGoroutineID   protowire.Number = 30
+	pbNumGoroutine  protowire.Number = 31
+	pbHeapAlloc     protowire.Number = 32
+)
+
+func EncodeProtobuf(rec *common.LogRecord) ([]byte, error) {
+	var b []byte
+	if len(rec.Context) != 0 {
+		ctx, err := contextToStruct(rec.Context)
+		if err != nil {
+			return nil, errors.Wrap(err, "while encoding context")
+		}
+		buf, err := proto.Marshal(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "while encoding context")
+		}
+		b = pbAppendBytes(b, pbContext, buf)
+	}
+	b = pbAppendString(b, pbCategory, rec.Category)
+	b = pbAppendString(b, pbAppName, rec.AppName)
+	b = pbAppendString(b, pbHostName, rec.HostName)
+	b = pbAppendString(b, pbLogLevel, rec.LogLevel)
+	b = pbAppendString(b, pbFileName, rec.FileName)
+	b = pbAppendString(b, pbFuncName, rec.FuncName)
+	b = pbAppendInt(b, pbLineNo, int64(rec.LineNo))
+	b = pbAppendString(b, pbMessage, rec.Message)
+
+	// google.protobuf.Timestamp
+	var ts []byte
+	t := rec.Timestamp.Time()
+	ts = pbAppendInt(ts, 1, t.Unix())
+	ts = pbAppendInt(ts, 2, int64(t.Nanosecond()))
+	b = pbAppendBytes(b, pbTimestamp, ts)
+
+	b = pbAppendString(b, pbCID, rec.CID)
+	b = pbAppendInt(b, pbPID, int64(rec.PID))
+	b = pbAppendString(b, pbPodName, rec.PodName)
+	b = pbAppendString(b, pbPodNamespace, rec.PodNamespace)
+	b = pbAppendString(b, pbNodeName, rec.NodeName)
+	b = pbAppendString(b, pbContainerName, rec.ContainerName)
+	b = pbAppendInt(b, pbGoroutineID, rec.GoroutineID)
+	b = pbAppendInt(b, pbNumGoroutine, int64(rec.NumGoroutine))
+	b = pbAppendInt(b, pbHeapAlloc, rec.HeapAlloc)
+	b = pbAppendString(b, pbTID, rec.TID)
+	b = pbAppendString(b, pbSpanID, rec.SpanID)
+	b = pbAppendString(b, pbTraceFlags, rec.TraceFlags)
+	b = pbAppendString(b, pbParentSpanID, rec.ParentSpanID)
+	b = pbAppendString(b, pbRequestID, rec.RequestID)
+	b = pbAppendString(b, pbSessionID, rec.SessionID)
+	b = pbAppendString(b, pbUserID, rec.UserID)
+	b = pbAppendString(b, pbTenantID, rec.TenantID)
+	b = pbAppendString(b, pbExcType, rec.ExcType)
+	b = pbAppendString(b, pbExcText, rec.ExcText)
+	b = pbAppendString(b, pbExcValue, rec.ExcValue)
+	for _, layer := range rec.ExcChain {
+		var l []byte
+		l = pbAppendString(l, 1, layer.Type)
+		l = pbAppendString(l, 2, layer.Message)
+		b = pbAppendBytes(b, pbExcChain, l)
+	}
+	for _, frame := range rec.Stack {
+		var f []byte
+		f = pbAppendString(f, 1, frame.FuncName)
+		f = pbAppendString(f, 2, frame.FileName)
+		f = pbAppendInt(f, 3, int64(frame.LineNo))
+		b = pbAppendBytes(b, pbStack, f)
+	}
+	return b, nil
+}
+
+func DecodeProtobuf(buf []byte) (*common.LogRecord, error) {
+	var rec common.LogRecord
+	err := pbConsumeFields(buf, func(num protowire.Number, value []byte, varint uint64) error {
+		switch num {
+		case pbContext:
+			var ctx structpb.Struct
+			if err := proto.Unmarshal(value, &ctx); err != nil {
+				return errors.Wrap(err, "while decoding context")
+			}
+			rec.Context = ctx.AsMap()
+		case pbCategory:
+			rec.Category = string(value)
+		case pbAppName:
+			rec.AppName = string(value)
+		case pbHostName:
+			rec.HostName = string(value)
+		case pbLogLevel:
+			rec.LogLevel = string(value)
+		case pbFileName:
+			rec.FileName = string(value)
+		case pbFuncName:
+			rec.FuncName = string(value)
+		case pbLineNo:
+			rec.LineNo = int(int64(varint))
+		case pbMessage:
+			rec.Message = string(value)
+		case pbTimestamp:
+			var sec, nsec int64
+			err := pbConsumeFields(value, func(num protowire.Number, _ []byte, varint uint64) error {
+				switch num {
+				case 1:
+					sec = int64(varint)
+				case 2:
+					nsec = int64(varint)
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "while decoding timestamp")
+			}
+			rec.Timestamp = common.TimeToNumber(time.Unix(sec, nsec))
+		case pbCID:
+			rec.CID = string(value)
+		case pbPID:
+			rec.PID = int(int64(varint))
+		case pbPodName:
+			rec.PodName = string(value)
+		case pbPodNamespace:
+			rec.PodNamespace = string(value)
+		case pbNodeName:
+			rec.NodeName = string(value)
+		case pbContainerName:
+			rec.ContainerName = string(value)
+		case pbGoroutineID:
+			rec.GoroutineID = int64(varint)
+		case pbNumGoroutine:
+			rec.NumGoroutine = int(int64(varint))
+		case pbHeapAlloc:
+			rec.HeapAlloc = int64(varint)
+		case pbTID:
+			rec.TID = string(value)
+		case pbSpanID:
+			rec.SpanID = string(value)
+		case pbTraceFlags:
+			rec.TraceFlags = string(value)
+		case pbParentSpanID:
+			rec.ParentSpanID = string(value)
+		case pbRequestID:
+			rec.RequestID = string(value)
+		case pbSessionID:
+			rec.SessionID = string(value)
+		case pbUserID:
+			rec.UserID = string(value)
+		case pbTenantID:
+			rec.TenantID = string(value)
+		case pbExcType:
+			rec.ExcType = string(value)
+		case pbExcText:
+			rec.ExcText = string(value)
+		case pbExcValue:
+			rec.ExcValue = string(value)
+		case pbExcChain:
+			var layer common.ExcLayer
+			err := pbConsumeFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				switch num {
+				case 1:
+					layer.Type = string(value)
+				case 2:
+					layer.Message = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "while decoding excChain")
+			}
+			rec.ExcChain = append(rec.ExcChain, layer)
+		case pbStack:
+			var frame common.StackFrame
+			err := pbConsumeFields(value, func(num protowire.Number, value []byte, varint uint64) error {
+				switch num {
+				case 1:
+					frame.FuncName = string(value)
+				case 2:
+					frame.FileName = string(value)
+				case 3:
+					frame.LineNo = int(int64(varint))
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "while decoding stack")
+			}
+			rec.Stack = append(rec.Stack, frame)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "while decoding protobuf")
+	}
+	return &rec, nil
+}
+
+// Converts the context to a protobuf struct, values structpb does not
+// support are converted to their JSON representation first
+func contextToStruct(ctx map[string]interface{}) (*structpb.Struct, error) {
+	result, err := structpb.NewStruct(ctx)
+	if err == nil {
+		return result, nil
+	}
+
+	buf, err := json.Marshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(buf, &normalized); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(normalized)
+}
+
+// Proto3 omits fields with the default value
+func pbAppendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func pbAppendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func pbAppendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// Calls fn for every field of the message, `value` is set for length
+// delimited fields and `varint` for varint fields. Other wire types are skipped.
+func pbConsumeFields(b []byte, fn func(num protowire.Number, value []byte, varint uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, v, 0); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, nil, v); err != nil {
+				return err
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package encoding_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v4"
+	. "gopkg.in/check.v1"
+)
+
+func TestEncoding(t *testing.T) { TestingT(t) }
+
+type EncodingTestSuite struct{}
+
+var _ = Suite(&EncodingTestSuite{})
+
+func newTestRecord() *common.LogRecord {
+	return &common.LogRecord{
+		Context: map[string]interface{}{
+			"domain": "example.com",
+			"http": map[string]interface{}{
+				"method": "POST",
+				"url":    "http://example.com",
+			},
+			"tags": []interface{}{"a", "b"},
+		},
+		Category:      "logrus",
+		AppName:       "binary.test",
+		HostName:      "localhost",
+		LogLevel:      "ERROR",
+		FileName:      "/src/binary/main.go",
+		FuncName:      "main.handler",
+		LineNo:        42,
+		Message:       "upstream failed",
+		Timestamp:     common.TimeToNumber(time.Date(2017, 1, 27, 1, 57, 25, 473685000, time.UTC)),
+		CID:           "d2ce1c0c6b3a",
+		PID:           3252,
+		PodName:       "api-7d4b9c-x2x8q",
+		PodNamespace:  "prod",
+		NodeName:      "node-1",
+		ContainerName: "api",
+		GoroutineID:   18,
+		NumGoroutine:  42,
+		HeapAlloc:     4194304,
+		TID:           "foo",
+		SpanID:        "b7ad6b7169203331",
+		TraceFlags:    "01",
+		ParentSpanID:  "53995c3f42cd8ad8",
+		RequestID:     "req-1",
+		SessionID:     "sess-1",
+		UserID:        "user-1",
+		TenantID:      "acme",
+		ExcType:       "*errors.fundamental",
+		ExcValue:      "upstream: timeout",
+		ExcText:       "upstream: timeout\nmain.handler",
+		ExcChain:      []common.ExcLayer{{Type: "*errors.fundamental", Message: "timeout"}},
+		Stack:         []common.StackFrame{{FuncName: "main.handler", FileName: "/src/binary/main.go", LineNo: 42}},
+	}
+}
+
+func (s *EncodingTestSuite) TestBinaryRoundTrip(c *C) {
+	for _, enc := range []encoding.Encoding{
+		encoding.JSON,
+		encoding.MsgPack,
+		encoding.CBOR,
+		encoding.Protobuf,
+	} {
+		fmt.Printf("Encoding %s\n", enc)
+		expected := newTestRecord()
+
+		f, err := encoding.NewFormatter(enc)
+		c.Assert(err, IsNil)
+		var buf []byte
+		if rf, ok := f.(interface {
+			Record(*logrus.Entry) *common.LogRecord
+		}); ok {
+			// Formatters share the record extraction of JSONFormater
+			c.Assert(rf.Record(&logrus.Entry{Message: "foo"}).Message, Equals, "foo")
+		}
+
+		switch enc {
+		case encoding.JSON:
+			buf, err = expected.MarshalJSON()
+		case encoding.MsgPack:
+			buf, err = encoding.EncodeMsgPack(expected)
+		case encoding.CBOR:
+			buf, err = encoding.EncodeCBOR(expected)
+		case encoding.Protobuf:
+			buf, err = encoding.EncodeProtobuf(expected)
+		}
+		c.Assert(err, IsNil)
+
+		rec, err := encoding.Decode(enc, buf)
+		c.Assert(err, IsNil)
+		c.Assert(rec.Timestamp.Time().Equal(expected.Timestamp.Time()), Equals, true)
+		c.Assert(rec.Context["domain"], Equals, "example.com")
+		c.Assert(rec.Context["http"].(map[string]interface{})["method"], Equals, "POST")
+		c.Assert(rec.Context["tags"], DeepEquals, []interface{}{"a", "b"})
+
+		rec.Timestamp, expected.Timestamp = 0, 0
+		rec.Context, expected.Context = nil, nil
+		c.Assert(rec, DeepEquals, expected)
+	}
+
+	_, err := encoding.NewFormatter("xml")
+	c.Assert(err, ErrorMatches, "unknown encoding 'xml'")
+}
+
+func (s *EncodingTestSuite) TestProtobufFormatter(c *C) {
+	entry := &logrus.Entry{
+		Logger:  logrus.New(),
+		Data:    logrus.Fields{"bar": struct{ Foo string }{Foo: "foo"}},
+		Time:    time.Now(),
+		Level:   logrus.WarnLevel,
+		Message: "Warn Called",
+	}
+
+	// When
+	buf, err := encoding.NewProtobufFormatter().Format(entry)
+	c.Assert(err, IsNil)
+
+	// Then
+	rec, err := encoding.DecodeProtobuf(buf)
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "Warn Called")
+	c.Assert(rec.LogLevel, Equals, "WARNING")
+	// Timestamps have microsecond precision
+	diff := rec.Timestamp.Time().Sub(entry.Time)
+	c.Assert(diff <= time.Microsecond && diff >= -time.Microsecond, Equals, true)
+	// Types structpb does not support are converted using JSON
+	c.Assert(rec.Context["bar"], DeepEquals, map[string]interface{}{"Foo": "foo"})
+}
+
+func (s *EncodingTestSuite) TestMsgPackTimestamp(c *C) {
+	rec := newTestRecord()
+	buf, err := encoding.EncodeMsgPack(rec)
+	c.Assert(err, IsNil)
+
+	// The timestamp is a msgpack timestamp
+	var decoded map[string]interface{}
+	c.Assert(msgpack.Unmarshal(buf, &decoded), IsNil)
+	c.Assert(decoded["timestamp"].(*time.Time).Equal(rec.Timestamp.Time()), Equals, true)
+
+	// Other importers of msgpack still encode a common.Number as a float
+	buf, err = msgpack.Marshal(common.Number(1.5))
+	c.Assert(err, IsNil)
+	var n interface{}
+	c.Assert(msgpack.Unmarshal(buf, &n), IsNil)
+	c.Assert(n, Equals, 1.5)
+
+	// Records without a timestamp omit it
+	rec.Timestamp = 0
+	buf, err = encoding.EncodeMsgPack(rec)
+	c.Assert(err, IsNil)
+	decoded = nil
+	c.Assert(msgpack.Unmarshal(buf, &decoded), IsNil)
+	_, ok := decoded["timestamp"]
+	c.Assert(ok, Equals, false)
+}
+
+func benchmarkEncode(b *testing.B, encode func(*common.LogRecord) ([]byte, error)) {
+	rec := newTestRecord()
+	var size int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, err := encode(rec)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(buf)
+	}
+	b.ReportMetric(float64(size), "bytes/record")
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	benchmarkEncode(b, func(rec *common.LogRecord) ([]byte, error) { return rec.MarshalJSON() })
+}
+
+func BenchmarkEncodeMsgPack(b *testing.B) {
+	benchmarkEncode(b, encoding.EncodeMsgPack)
+}
+
+func BenchmarkEncodeCBOR(b *testing.B) {
+	benchmarkEncode(b, encoding.EncodeCBOR)
+}
+
+func BenchmarkEncodeProtobuf(b *testing.B) {
+	benchmarkEncode(b, encoding.EncodeProtobuf)
+}
+
+func benchmarkDecode(b *testing.B, enc encoding.Encoding, encode func(*common.LogRecord) ([]byte, error)) {
+	buf, err := encode(newTestRecord())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encoding.Decode(enc, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	benchmarkDecode(b, encoding.JSON, func(rec *common.LogRecord) ([]byte, error) { return rec.MarshalJSON() })
+}
+
+func BenchmarkDecodeMsgPack(b *testing.B) {
+	benchmarkDecode(b, encoding.MsgPack, encoding.EncodeMsgPack)
+}
+
+func BenchmarkDecodeCBOR(b *testing.B) {
+	benchmarkDecode(b, encoding.CBOR, encoding.EncodeCBOR)
+}
+
+func BenchmarkDecodeProtobuf(b *testing.B) {
+	benchmarkDecode(b, encoding.Protobuf, encoding.EncodeProtobuf)
+}
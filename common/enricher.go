@@ -0,0 +1,92 @@
+package common
+
+import (
+	"os"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Enricher adds deployment or runtime metadata to the records of a
+// JSONFormater. Enrich is called for every record after the fields and the
+// context of the entry are recorded, possibly from several goroutines at once.
+type Enricher interface {
+	Enrich(entry *logrus.Entry, rec *LogRecord)
+}
+
+// EnricherFunc adapts a function to the Enricher interface, ie
+//
+//	formatter.Enrichers = append(formatter.Enrichers, common.EnricherFunc(
+//	    func(entry *logrus.Entry, rec *common.LogRecord) {
+//	        common.AddContext(rec, "leader", election.IsLeader())
+//	    }))
+type EnricherFunc func(entry *logrus.Entry, rec *LogRecord)
+
+func (f EnricherFunc) Enrich(entry *logrus.Entry, rec *LogRecord) {
+	f(entry, rec)
+}
+
+type staticEnricher map[string]interface{}
+
+// StaticEnricher records the values of the map in the `context` of every
+// record, ie the region or the cluster of the deployment
+func StaticEnricher(values map[string]interface{}) Enricher {
+	static := make(staticEnricher, len(values))
+	for k, v := range values {
+		static[k] = v
+	}
+	return static
+}
+
+func (s staticEnricher) Enrich(_ *logrus.Entry, rec *LogRecord) {
+	for k, v := range s {
+		AddContext(rec, k, v)
+	}
+}
+
+// EnvEnricher records the value of environment variables in the `context` of
+// every record. The keys of the map are names in the context, the values are
+// the names of the variables. Variables are read once, those which are not
+// set are not recorded.
+//
+//	common.EnvEnricher(map[string]string{
+//	    "deploy.env":     "DEPLOY_ENV",
+//	    "deploy.cluster": "CLUSTER_NAME",
+//	})
+func EnvEnricher(vars map[string]string) Enricher {
+	static := make(staticEnricher, len(vars))
+	for name, env := range vars {
+		if v, ok := os.LookupEnv(env); ok {
+			static[name] = v
+		}
+	}
+	return static
+}
+
+// BuildInfoEnricher records the build information embedded in the binary in
+// the `build` object of the `context` of every record
+//
+//	path      import path of the main package
+//	version   version of the main module, `(devel)` when built from a checkout
+//	goVersion version of the go toolchain
+//	revision  vcs revision the binary was built from
+//	time      time of the vcs revision
+//	modified  true if the checkout had uncommitted changes
+//
+// The vcs fields are only available with go 1.18 or later and when built with
+// vcs stamping. Records are not enriched if the build information is not
+// available.
+func BuildInfoEnricher() Enricher {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return staticEnricher{}
+	}
+	static := staticEnricher{
+		"build.path":    info.Path,
+		"build.version": info.Main.Version,
+	}
+	for k, v := range buildSettings(info) {
+		static["build."+k] = v
+	}
+	return static
+}
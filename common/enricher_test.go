@@ -0,0 +1,84 @@
+package common_test
+
+import (
+	"context"
+	"os"
+	"runtime/debug"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CommonTestSuite) TestEnrichers(c *C) {
+	os.Setenv("LOGRUS_HOOKS_TEST_ENV", "prod")
+	defer os.Unsetenv("LOGRUS_HOOKS_TEST_ENV")
+
+	values := map[string]interface{}{"deploy.region": "us-east-1", "cluster": "blue"}
+	leader := false
+
+	f := common.NewJSONFormater()
+	f.ContextExtractors = append(f.ContextExtractors, common.ContextValueExtractor(jobIDKey{}, "job_id"))
+	f.Enrichers = []common.Enricher{
+		common.StaticEnricher(values),
+		common.EnvEnricher(map[string]string{
+			"deploy.env":   "LOGRUS_HOOKS_TEST_ENV",
+			"deploy.unset": "LOGRUS_HOOKS_TEST_UNSET",
+		}),
+		common.EnricherFunc(func(entry *logrus.Entry, rec *common.LogRecord) {
+			common.AddContext(rec, "leader", leader)
+			if entry.Level == logrus.ErrorLevel {
+				rec.RequestID = "req-1"
+			}
+		}),
+	}
+	// Changes to the map do not affect the enricher
+	values["cluster"] = "green"
+
+	log := logrus.New()
+	rec := f.Record(logrus.NewEntry(log))
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{
+		"cluster": "blue",
+		"deploy":  map[string]interface{}{"region": "us-east-1", "env": "prod"},
+		"leader":  false,
+	})
+	c.Assert(rec.RequestID, Equals, "")
+
+	// Dynamic enrichers are called for every record
+	leader = true
+	entry := logrus.NewEntry(log)
+	entry.Level = logrus.ErrorLevel
+	rec = f.Record(entry)
+	c.Assert(rec.Context["leader"], Equals, true)
+	c.Assert(rec.RequestID, Equals, "req-1")
+
+	// Fields and context extractors have precedence over enrichers
+	ctx := context.WithValue(context.Background(), jobIDKey{}, "job-1")
+	rec = f.Record(log.WithContext(ctx).WithFields(logrus.Fields{
+		"cluster":       "red",
+		"deploy.region": "eu-west-1",
+		"job_id":        "job-2",
+	}))
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{
+		"cluster": "red",
+		"deploy":  map[string]interface{}{"region": "eu-west-1", "env": "prod"},
+		"job_id":  "job-2",
+		"leader":  true,
+	})
+
+	buf, err := f.Format(logrus.NewEntry(log))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Matches, `\{"context":\{.*"env":"prod".*\},"category":"logrus",.*\n`)
+}
+
+func (s *CommonTestSuite) TestBuildInfoEnricher(c *C) {
+	info, ok := debug.ReadBuildInfo()
+	c.Assert(ok, Equals, true)
+
+	var rec common.LogRecord
+	common.BuildInfoEnricher().Enrich(nil, &rec)
+	build, ok := rec.Context["build"].(map[string]interface{})
+	c.Assert(ok, Equals, true)
+	c.Assert(build["path"], Equals, info.Path)
+	c.Assert(build["version"], Equals, info.Main.Version)
+}
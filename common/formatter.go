@@ -3,6 +3,7 @@ package common
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/mailgun/holster/v3/callstack"
@@ -24,48 +25,165 @@ func NewJSONFormater() *JSONFormater {
 	if f.pid = os.Getpid(); f.pid == 1 {
 		f.pid = 0
 	}
-	f.cid = GetDockerCID()
+	f.SetMetadata(DetectMetadata())
+	f.ContextExtractors = DefaultContextExtractors
+	f.StackLevel = logrus.ErrorLevel
 	return &f
 }
 
-func (f *JSONFormater) Format(entry *logrus.Entry) ([]byte, error) {
+// Record returns the LogRecord for the entry, this is the record Format()
+// marshals and the source of every other formatter in this package.
+func (f *JSONFormater) Record(entry *logrus.Entry) *LogRecord {
 	var caller *callstack.FrameInfo
 
-	caller = GetLogrusCaller()
+	// Hooks which format on another goroutine capture the caller in the entry
+	if entry.Caller != nil {
+		caller = &callstack.FrameInfo{
+			Func:   shortFuncName(entry.Caller.Function),
+			File:   entry.Caller.File,
+			LineNo: entry.Caller.Line,
+		}
+	} else {
+		caller = GetLogrusCaller()
+	}
 
 	rec := &LogRecord{
-		Category:  "logrus",
-		AppName:   f.appName,
-		HostName:  f.hostName,
-		LogLevel:  strings.ToUpper(entry.Level.String()),
-		FileName:  caller.File,
-		FuncName:  caller.Func,
-		LineNo:    caller.LineNo,
-		Message:   entry.Message,
-		Context:   nil,
-		Timestamp: Number(float64(entry.Time.UnixNano()) / 1000000000),
-		CID:       f.cid,
-		PID:       f.pid,
+		Category:      "logrus",
+		AppName:       f.appName,
+		HostName:      f.hostName,
+		LogLevel:      strings.ToUpper(entry.Level.String()),
+		FileName:      caller.File,
+		FuncName:      caller.Func,
+		LineNo:        caller.LineNo,
+		Message:       entry.Message,
+		Context:       nil,
+		Timestamp:     TimeToNumber(entry.Time),
+		CID:           f.cid,
+		PID:           f.pid,
+		PodName:       f.metadata.PodName,
+		PodNamespace:  f.metadata.Namespace,
+		NodeName:      f.metadata.NodeName,
+		ContainerName: f.metadata.ContainerName,
+	}
+	rec.FromFieldsWithOptions(entry.Data, f.FieldOptions)
+	if entry.Context != nil {
+		for _, extract := range f.ContextExtractors {
+			extract(entry.Context, rec)
+		}
+	}
+	for _, e := range f.Enrichers {
+		e.Enrich(entry, rec)
+	}
+
+	if f.CaptureGoroutineID {
+		rec.GoroutineID = goroutineID()
+	}
+	if f.CaptureNumGoroutine {
+		rec.NumGoroutine = runtime.NumGoroutine()
+	}
+	if f.CaptureHeapAlloc {
+		rec.HeapAlloc = heapAlloc()
+	}
+
+	if f.CaptureStack && entry.Level <= f.StackLevel {
+		rec.Stack = GetLogrusStack(f.StackMaxFrames, !f.KeepInternalFrames)
+	}
+	return rec
+}
+
+func (f *JSONFormater) Format(entry *logrus.Entry) ([]byte, error) {
+	rec := f.Record(entry)
+
+	name := f.TimestampFieldName
+	if name == "" {
+		name = "timestamp"
+	}
+	precision := DefaultTimestampPrecision
+	if f.TimestampPrecision != nil {
+		precision = *f.TimestampPrecision
+	}
+	custom := name != "timestamp" || f.TimestampFormat != TimestampEpoch ||
+		precision != DefaultTimestampPrecision
+	if custom {
+		if name != "timestamp" && recordFields[name] {
+			return nil, errors.Errorf("timestamp field name '%s' is the name of a record field", name)
+		}
+		// The zero timestamp is omitted, the formatted timestamp is written last
+		rec.Timestamp = 0
 	}
-	rec.FromFields(entry.Data)
 
 	var w jwriter.Writer
 	rec.MarshalEasyJSON(&w)
 	if w.Error != nil {
 		return nil, errors.Wrap(w.Error, "while marshalling json")
 	}
+	buf := w.Buffer.BuildBytes()
 
-	// Append a newline to the formatted record
-	w.Buffer.AppendByte(byte(0x0a))
+	if custom {
+		// Replace the closing brace of the record
+		var ts jwriter.Writer
+		ts.RawByte(',')
+		ts.String(name)
+		ts.RawByte(':')
+		writeTimestamp(&ts, entry.Time, f.TimestampFormat, precision)
+		ts.RawByte('}')
+		buf = append(buf[:len(buf)-1], ts.Buffer.BuildBytes()...)
+	}
 
-	buf := w.Buffer.BuildBytes()
+	// Append a newline to the formatted record
+	return append(buf, byte(0x0a)), nil
+}
 
-	return buf, nil
+// SetMetadata replaces the container and Kubernetes metadata added to every
+// record, which NewJSONFormater() detects with DetectMetadata()
+func (f *JSONFormater) SetMetadata(md Metadata) {
+	f.metadata = md
+	f.cid = shortContainerID(md.ContainerID)
 }
 
 type JSONFormater struct {
+	FieldOptions
+
+	// Copy values from the context of entries logged with logrus.WithContext()
+	// into the record, defaults to DefaultContextExtractors
+	ContextExtractors []ContextExtractor
+	// Add deployment or runtime metadata to every record, run in order after
+	// the ContextExtractors
+	Enrichers []Enricher
+
+	// If true, the goroutine stack is captured in the `stack` field of
+	// records with a level of StackLevel or more severe. The stack is not
+	// captured by hooks which format entries on another goroutine.
+	CaptureStack bool
+	// Defaults to logrus.ErrorLevel with NewJSONFormater(), the zero value
+	// only captures the stack of panics
+	StackLevel logrus.Level
+	// Maximum number of stack frames captured, defaults to DefaultStackFrames
+	StackMaxFrames int
+	// If true, logrus and go runtime frames are not trimmed from the stack
+	KeepInternalFrames bool
+
+	// If true, the ID of the goroutine which formats the entry is recorded in
+	// `goroutineId`. Hooks which format entries on another goroutine, like
+	// asynchook, record the ID of their own goroutine.
+	CaptureGoroutineID bool
+	// If true, the number of goroutines is recorded in `numGoroutine`
+	CaptureNumGoroutine bool
+	// If true, the bytes of allocated heap objects are recorded in
+	// `heapAlloc`, sampled at most once per HeapSampleInterval
+	CaptureHeapAlloc bool
+
+	// Format of the `timestamp` field, defaults to TimestampEpoch
+	TimestampFormat TimestampFormat
+	// Number of decimal places used by TimestampEpoch, 0 for whole seconds.
+	// Defaults to DefaultTimestampPrecision when nil.
+	TimestampPrecision *int
+	// Name of the timestamp field, defaults to `timestamp`
+	TimestampFieldName string
+
 	appName  string
 	hostName string
 	cid      string
+	metadata Metadata
 	pid      int
 }
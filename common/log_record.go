@@ -2,6 +2,8 @@ package common
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/mailgun/holster/v3/callstack"
 	"github.com/mailgun/holster/v3/errors"
@@ -16,63 +18,172 @@ func (n Number) MarshalJSON() ([]byte, error) {
 
 //easyjson:json
 type LogRecord struct {
-	Context   map[string]interface{} `json:"context,omitempty"`
-	Category  string                 `json:"category,omitempty"`
-	AppName   string                 `json:"appname"`
-	HostName  string                 `json:"hostname"`
-	LogLevel  string                 `json:"logLevel"`
-	FileName  string                 `json:"filename"`
-	FuncName  string                 `json:"funcName"`
-	LineNo    int                    `json:"lineno"`
-	Message   string                 `json:"message"`
-	Timestamp Number                 `json:"timestamp"`
-	CID       string                 `json:"cid,omitempty"`
-	PID       int                    `json:"pid,omitempty"`
-	TID       string                 `json:"tid,omitempty"`
-	ExcType   string                 `json:"excType,omitempty"`
-	ExcText   string                 `json:"excText,omitempty"`
-	ExcValue  string                 `json:"excValue,omitempty"`
+	Context       map[string]interface{} `json:"context,omitempty"`
+	Category      string                 `json:"category,omitempty"`
+	AppName       string                 `json:"appname"`
+	HostName      string                 `json:"hostname"`
+	LogLevel      string                 `json:"logLevel"`
+	FileName      string                 `json:"filename"`
+	FuncName      string                 `json:"funcName"`
+	LineNo        int                    `json:"lineno"`
+	Message       string                 `json:"message"`
+	Timestamp     Number                 `json:"timestamp,omitempty"`
+	CID           string                 `json:"cid,omitempty"`
+	PID           int                    `json:"pid,omitempty"`
+	PodName       string                 `json:"podName,omitempty"`
+	PodNamespace  string                 `json:"podNamespace,omitempty"`
+	NodeName      string                 `json:"nodeName,omitempty"`
+	ContainerName string                 `json:"containerName,omitempty"`
+	GoroutineID   int64                  `json:"goroutineId,omitempty"`
+	NumGoroutine  int                    `json:"numGoroutine,omitempty"`
+	HeapAlloc     int64                  `json:"heapAlloc,omitempty"`
+	TID           string                 `json:"tid,omitempty"`
+	SpanID        string                 `json:"spanId,omitempty"`
+	TraceFlags    string                 `json:"traceFlags,omitempty"`
+	ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+	RequestID     string                 `json:"requestId,omitempty"`
+	SessionID     string                 `json:"sessionId,omitempty"`
+	UserID        string                 `json:"userId,omitempty"`
+	TenantID      string                 `json:"tenantId,omitempty"`
+	ExcType       string                 `json:"excType,omitempty"`
+	ExcText       string                 `json:"excText,omitempty"`
+	ExcValue      string                 `json:"excValue,omitempty"`
+	ExcChain      []ExcLayer             `json:"excChain,omitempty"`
+	Stack         []StackFrame           `json:"stack,omitempty"`
+}
+
+// The type and message of a single layer of a wrapped error
+type ExcLayer struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// A single frame of the stack captured by JSONFormater
+type StackFrame struct {
+	FuncName string `json:"funcName"`
+	FileName string `json:"filename"`
+	LineNo   int    `json:"lineno"`
+}
+
+// FieldOptions control how logrus fields are interpreted by FromFieldsWithOptions
+type FieldOptions struct {
+	// If true, the type and message of every layer of a wrapped error is
+	// recorded in `excChain`
+	ErrorChain bool
+	// Fields searched in order for the error recorded in the `exc` fields,
+	// defaults to DefaultErrorKeys. With the default keys, if neither is set
+	// the first field in sorted order named with an `_err` or `_error` suffix,
+	// ie `upstream_err`, is recorded. Other fields with error values are
+	// recorded in the context as returned by ErrorToMap().
+	ErrorKeys []string
+	// If true, the logrus fields with the well known correlation names, ie
+	// `request_id` or `userId`, are recorded in the correlation fields of the
+	// record instead of the context. The `tid` field is always recorded in
+	// `tid`. When several names of a field are set `tid` has precedence over
+	// `traceId` and `trace_id`, camel case names have precedence over snake
+	// case names, and the others are recorded in the context.
+	CorrelationFields bool
+}
+
+// logrus.WithError adds a field with name error.
+var DefaultErrorKeys = []string{"err", "error"}
+
+// Returns the first field in sorted order with an error value and a name
+// ending with `_err` or `_error`
+func suffixedErrorKey(fields logrus.Fields) string {
+	var keys []string
+	for k, v := range fields {
+		if _, ok := v.(error); !ok {
+			continue
+		}
+		if strings.HasSuffix(k, "_err") || strings.HasSuffix(k, "_error") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	return keys[0]
+}
+
+// The well known names of the logrus fields recorded in the correlation
+// fields of the record, in order of precedence when several are set
+var correlationFields = []struct {
+	names []string
+	field func(r *LogRecord) *string
+}{
+	{[]string{"tid", "traceId", "trace_id"}, func(r *LogRecord) *string { return &r.TID }},
+	{[]string{"spanId", "span_id"}, func(r *LogRecord) *string { return &r.SpanID }},
+	{[]string{"traceFlags", "trace_flags"}, func(r *LogRecord) *string { return &r.TraceFlags }},
+	{[]string{"parentSpanId", "parent_span_id"}, func(r *LogRecord) *string { return &r.ParentSpanID }},
+	{[]string{"requestId", "request_id"}, func(r *LogRecord) *string { return &r.RequestID }},
+	{[]string{"sessionId", "session_id"}, func(r *LogRecord) *string { return &r.SessionID }},
+	{[]string{"userId", "user_id"}, func(r *LogRecord) *string { return &r.UserID }},
+	{[]string{"tenantId", "tenant_id"}, func(r *LogRecord) *string { return &r.TenantID }},
+}
+
+// Records the correlation fields of the record and returns the names of the
+// logrus fields it recorded. Only `tid` is recorded unless all is true.
+func (r *LogRecord) fromCorrelationFields(fields logrus.Fields, all bool) map[string]bool {
+	recorded := make(map[string]bool)
+	for _, cf := range correlationFields {
+		for _, name := range cf.names {
+			if !all && name != "tid" {
+				continue
+			}
+			if v, ok := fields[name].(string); ok {
+				*cf.field(r) = v
+				recorded[name] = true
+				break
+			}
+		}
+	}
+	return recorded
 }
 
 func (r *LogRecord) FromFields(fields logrus.Fields) {
+	r.FromFieldsWithOptions(fields, FieldOptions{})
+}
+
+func (r *LogRecord) FromFieldsWithOptions(fields logrus.Fields, opts FieldOptions) {
 	if len(fields) == 0 {
 		return
 	}
 	r.Context = make(map[string]interface{})
+
+	// Choose which error is recorded in the exc fields
+	errorKeys := opts.ErrorKeys
+	if errorKeys == nil {
+		errorKeys = DefaultErrorKeys
+	}
+	var primary string
+	for _, k := range errorKeys {
+		if _, ok := fields[k].(error); ok {
+			primary = k
+			break
+		}
+	}
+	if primary == "" && opts.ErrorKeys == nil {
+		primary = suffixedErrorKey(fields)
+	}
+
+	correlated := r.fromCorrelationFields(fields, opts.CorrelationFields)
 	for k, v := range fields {
-		switch k {
-		// logrus.WithError adds a field with name error.
-		case "error":
-			fallthrough
-		case "err":
-			// Record details of the error
-			if v, ok := v.(error); ok {
-				r.ExcValue = v.Error()
-				r.ExcType = fmt.Sprintf("%T", errors.Cause(v))
-				r.ExcText = fmt.Sprintf("%+v", v)
-
-				// Extract the stack info if provided
-				if v, ok := v.(callstack.HasStackTrace); ok {
-					trace := v.StackTrace()
-					caller := callstack.GetLastFrame(trace)
-					r.FuncName = caller.Func
-					r.LineNo = caller.LineNo
-					r.FileName = caller.File
-				}
-
-				// Extract context if provided
-				if ctx, ok := v.(errors.HasContext); ok {
-					for ck, cv := range ctx.Context() {
-						r.Context[ck] = cv
-					}
-				}
-				continue
-			}
-		case "tid":
-			if v, ok := v.(string); ok {
-				r.TID = v
-				continue
+		if correlated[k] {
+			continue
+		}
+		if v, ok := v.(error); ok {
+			if k == primary {
+				// Record details of the error
+				r.fromError(v, opts)
+			} else {
+				ExpandNested(k, ErrorToMap(v), r.Context)
 			}
+			continue
+		}
+
+		switch k {
 		case "excValue":
 			if v, ok := v.(string); ok {
 				r.ExcValue = v
@@ -112,3 +223,115 @@ func (r *LogRecord) FromFields(fields logrus.Fields) {
 		ExpandNested(k, v, r.Context)
 	}
 }
+
+// Records the details of the error, walking every layer of the error chain
+func (r *LogRecord) fromError(err error, opts FieldOptions) {
+	r.ExcValue = err.Error()
+	r.ExcText = fmt.Sprintf("%+v", err)
+
+	var cause error
+	var stack callstack.HasStackTrace
+	var contexts []map[string]interface{}
+	walkErrors(err, func(layer error, leaf bool) {
+		if opts.ErrorChain {
+			r.ExcChain = append(r.ExcChain, ExcLayer{
+				Type:    fmt.Sprintf("%T", layer),
+				Message: layer.Error(),
+			})
+		}
+		// The first leaf is the root cause
+		if leaf && cause == nil {
+			cause = layer
+		}
+		// The innermost stack is closest to where the error occurred
+		if v, ok := layer.(callstack.HasStackTrace); ok {
+			stack = v
+		}
+		if v, ok := layer.(errors.HasContext); ok {
+			contexts = append(contexts, v.Context())
+		}
+	})
+	r.ExcType = fmt.Sprintf("%T", cause)
+
+	// Extract the stack info if provided
+	if stack != nil {
+		caller := callstack.GetLastFrame(stack.StackTrace())
+		r.FuncName = caller.Func
+		r.LineNo = caller.LineNo
+		r.FileName = caller.File
+	}
+
+	// Extract context if provided, inner layers have precedence as they
+	// are closer to the cause
+	for _, ctx := range contexts {
+		for ck, cv := range ctx {
+			r.Context[ck] = cv
+		}
+	}
+}
+
+// Given an error return a map with the message, type and context of the error
+func ErrorToMap(err error) map[string]interface{} {
+	var cause error
+	context := make(map[string]interface{})
+	walkErrors(err, func(layer error, leaf bool) {
+		if leaf && cause == nil {
+			cause = layer
+		}
+		if v, ok := layer.(errors.HasContext); ok {
+			for ck, cv := range v.Context() {
+				context[ck] = cv
+			}
+		}
+	})
+
+	result := map[string]interface{}{
+		"message": err.Error(),
+		"type":    fmt.Sprintf("%T", cause),
+	}
+	if len(context) != 0 {
+		result["context"] = context
+	}
+	return result
+}
+
+// The maximum number of layers walkErrors will visit, this protects against
+// errors that return themselves as their cause.
+const maxErrorLayers = 100
+
+// Calls fn for the error and every error it wraps, outermost first. Errors
+// are unwrapped using `Unwrap() []error` as returned by errors.Join(),
+// `Unwrap() error` as returned by fmt.Errorf("%w") and `Cause() error` as
+// returned by errors.Wrap().
+func walkErrors(err error, fn func(layer error, leaf bool)) {
+	var visited int
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || visited == maxErrorLayers {
+			return
+		}
+		visited++
+
+		var children []error
+		switch v := err.(type) {
+		case interface{ Unwrap() []error }:
+			children = v.Unwrap()
+		case interface{ Unwrap() error }:
+			children = []error{v.Unwrap()}
+		case interface{ Cause() error }:
+			children = []error{v.Cause()}
+		}
+
+		leaf := true
+		for _, child := range children {
+			if child != nil {
+				leaf = false
+			}
+		}
+		fn(err, leaf)
+		for _, child := range children {
+			walk(child)
+		}
+	}
+	walk(err)
+}
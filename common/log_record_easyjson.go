@@ -79,19 +79,93 @@ func easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon(in *jlexer.Lexer, o
 		case "message":
 			out.Message = string(in.String())
 		case "timestamp":
-			out.Timestamp = Number(in.Float64())
+			(out.Timestamp).UnmarshalEasyJSON(in)
 		case "cid":
 			out.CID = string(in.String())
 		case "pid":
 			out.PID = int(in.Int())
+		case "podName":
+			out.PodName = string(in.String())
+		case "podNamespace":
+			out.PodNamespace = string(in.String())
+		case "nodeName":
+			out.NodeName = string(in.String())
+		case "containerName":
+			out.ContainerName = string(in.String())
+		case "goroutineId":
+			out.GoroutineID = int64(in.Int64())
+		case "numGoroutine":
+			out.NumGoroutine = int(in.Int())
+		case "heapAlloc":
+			out.HeapAlloc = int64(in.Int64())
 		case "tid":
 			out.TID = string(in.String())
+		case "spanId":
+			out.SpanID = string(in.String())
+		case "traceFlags":
+			out.TraceFlags = string(in.String())
+		case "parentSpanId":
+			out.ParentSpanID = string(in.String())
+		case "requestId":
+			out.RequestID = string(in.String())
+		case "sessionId":
+			out.SessionID = string(in.String())
+		case "userId":
+			out.UserID = string(in.String())
+		case "tenantId":
+			out.TenantID = string(in.String())
 		case "excType":
 			out.ExcType = string(in.String())
 		case "excText":
 			out.ExcText = string(in.String())
 		case "excValue":
 			out.ExcValue = string(in.String())
+		case "excChain":
+			if in.IsNull() {
+				in.Skip()
+				out.ExcChain = nil
+			} else {
+				in.Delim('[')
+				if out.ExcChain == nil {
+					if !in.IsDelim(']') {
+						out.ExcChain = make([]ExcLayer, 0, 2)
+					} else {
+						out.ExcChain = []ExcLayer{}
+					}
+				} else {
+					out.ExcChain = (out.ExcChain)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v2 ExcLayer
+					easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon1(in, &v2)
+					out.ExcChain = append(out.ExcChain, v2)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "stack":
+			if in.IsNull() {
+				in.Skip()
+				out.Stack = nil
+			} else {
+				in.Delim('[')
+				if out.Stack == nil {
+					if !in.IsDelim(']') {
+						out.Stack = make([]StackFrame, 0, 1)
+					} else {
+						out.Stack = []StackFrame{}
+					}
+				} else {
+					out.Stack = (out.Stack)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v3 StackFrame
+					easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon2(in, &v3)
+					out.Stack = append(out.Stack, v3)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -108,29 +182,25 @@ func easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon(out *jwriter.Writer
 	_ = first
 	if len(in.Context) != 0 {
 		const prefix string = ",\"context\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		first = false
+		out.RawString(prefix[1:])
 		{
 			out.RawByte('{')
-			v2First := true
-			for v2Name, v2Value := range in.Context {
-				if v2First {
-					v2First = false
+			v4First := true
+			for v4Name, v4Value := range in.Context {
+				if v4First {
+					v4First = false
 				} else {
 					out.RawByte(',')
 				}
-				out.String(string(v2Name))
+				out.String(string(v4Name))
 				out.RawByte(':')
-				if m, ok := v2Value.(easyjson.Marshaler); ok {
+				if m, ok := v4Value.(easyjson.Marshaler); ok {
 					m.MarshalEasyJSON(out)
-				} else if m, ok := v2Value.(json.Marshaler); ok {
+				} else if m, ok := v4Value.(json.Marshaler); ok {
 					out.Raw(m.MarshalJSON())
 				} else {
-					out.Raw(json.Marshal(v2Value))
+					out.Raw(json.Marshal(v4Value))
 				}
 			}
 			out.RawByte('}')
@@ -158,134 +228,167 @@ func easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon(out *jwriter.Writer
 	}
 	{
 		const prefix string = ",\"hostname\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.HostName))
 	}
 	{
 		const prefix string = ",\"logLevel\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.LogLevel))
 	}
 	{
 		const prefix string = ",\"filename\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.FileName))
 	}
 	{
 		const prefix string = ",\"funcName\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.FuncName))
 	}
 	{
 		const prefix string = ",\"lineno\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.Int(int(in.LineNo))
 	}
 	{
 		const prefix string = ",\"message\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.Message))
 	}
-	{
+	if in.Timestamp != 0 {
 		const prefix string = ",\"timestamp\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
-		out.Raw((in.Timestamp).MarshalJSON())
+		out.RawString(prefix)
+		(in.Timestamp).MarshalEasyJSON(out)
 	}
 	if in.CID != "" {
 		const prefix string = ",\"cid\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.CID))
 	}
 	if in.PID != 0 {
 		const prefix string = ",\"pid\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.Int(int(in.PID))
 	}
+	if in.PodName != "" {
+		const prefix string = ",\"podName\":"
+		out.RawString(prefix)
+		out.String(string(in.PodName))
+	}
+	if in.PodNamespace != "" {
+		const prefix string = ",\"podNamespace\":"
+		out.RawString(prefix)
+		out.String(string(in.PodNamespace))
+	}
+	if in.NodeName != "" {
+		const prefix string = ",\"nodeName\":"
+		out.RawString(prefix)
+		out.String(string(in.NodeName))
+	}
+	if in.ContainerName != "" {
+		const prefix string = ",\"containerName\":"
+		out.RawString(prefix)
+		out.String(string(in.ContainerName))
+	}
+	if in.GoroutineID != 0 {
+		const prefix string = ",\"goroutineId\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.GoroutineID))
+	}
+	if in.NumGoroutine != 0 {
+		const prefix string = ",\"numGoroutine\":"
+		out.RawString(prefix)
+		out.Int(int(in.NumGoroutine))
+	}
+	if in.HeapAlloc != 0 {
+		const prefix string = ",\"heapAlloc\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.HeapAlloc))
+	}
 	if in.TID != "" {
 		const prefix string = ",\"tid\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.TID))
 	}
+	if in.SpanID != "" {
+		const prefix string = ",\"spanId\":"
+		out.RawString(prefix)
+		out.String(string(in.SpanID))
+	}
+	if in.TraceFlags != "" {
+		const prefix string = ",\"traceFlags\":"
+		out.RawString(prefix)
+		out.String(string(in.TraceFlags))
+	}
+	if in.ParentSpanID != "" {
+		const prefix string = ",\"parentSpanId\":"
+		out.RawString(prefix)
+		out.String(string(in.ParentSpanID))
+	}
+	if in.RequestID != "" {
+		const prefix string = ",\"requestId\":"
+		out.RawString(prefix)
+		out.String(string(in.RequestID))
+	}
+	if in.SessionID != "" {
+		const prefix string = ",\"sessionId\":"
+		out.RawString(prefix)
+		out.String(string(in.SessionID))
+	}
+	if in.UserID != "" {
+		const prefix string = ",\"userId\":"
+		out.RawString(prefix)
+		out.String(string(in.UserID))
+	}
+	if in.TenantID != "" {
+		const prefix string = ",\"tenantId\":"
+		out.RawString(prefix)
+		out.String(string(in.TenantID))
+	}
 	if in.ExcType != "" {
 		const prefix string = ",\"excType\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.ExcType))
 	}
 	if in.ExcText != "" {
 		const prefix string = ",\"excText\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.ExcText))
 	}
 	if in.ExcValue != "" {
 		const prefix string = ",\"excValue\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.ExcValue))
 	}
+	if len(in.ExcChain) != 0 {
+		const prefix string = ",\"excChain\":"
+		out.RawString(prefix)
+		{
+			out.RawByte('[')
+			for v5, v6 := range in.ExcChain {
+				if v5 > 0 {
+					out.RawByte(',')
+				}
+				easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon1(out, v6)
+			}
+			out.RawByte(']')
+		}
+	}
+	if len(in.Stack) != 0 {
+		const prefix string = ",\"stack\":"
+		out.RawString(prefix)
+		{
+			out.RawByte('[')
+			for v7, v8 := range in.Stack {
+				if v7 > 0 {
+					out.RawByte(',')
+				}
+				easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon2(out, v8)
+			}
+			out.RawByte(']')
+		}
+	}
 	out.RawByte('}')
 }
 
@@ -312,3 +415,108 @@ func (v *LogRecord) UnmarshalJSON(data []byte) error {
 func (v *LogRecord) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon(l, v)
 }
+func easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon2(in *jlexer.Lexer, out *StackFrame) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeString()
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "funcName":
+			out.FuncName = string(in.String())
+		case "filename":
+			out.FileName = string(in.String())
+		case "lineno":
+			out.LineNo = int(in.Int())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon2(out *jwriter.Writer, in StackFrame) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"funcName\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.FuncName))
+	}
+	{
+		const prefix string = ",\"filename\":"
+		out.RawString(prefix)
+		out.String(string(in.FileName))
+	}
+	{
+		const prefix string = ",\"lineno\":"
+		out.RawString(prefix)
+		out.Int(int(in.LineNo))
+	}
+	out.RawByte('}')
+}
+func easyjson500470b6DecodeGithubComMailgunLogrusHooksCommon1(in *jlexer.Lexer, out *ExcLayer) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeString()
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "type":
+			out.Type = string(in.String())
+		case "message":
+			out.Message = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson500470b6EncodeGithubComMailgunLogrusHooksCommon1(out *jwriter.Writer, in ExcLayer) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"type\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Type))
+	}
+	{
+		const prefix string = ",\"message\":"
+		out.RawString(prefix)
+		out.String(string(in.Message))
+	}
+	out.RawByte('}')
+}
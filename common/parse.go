@@ -0,0 +1,255 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mailru/easyjson/jlexer"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Records with a timestamp before this time fail validation
+var MinRecordTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Records with a timestamp further in the future than this fail validation
+const MaxRecordClockSkew = 24 * time.Hour
+
+// The JSON names of all the LogRecord fields and those that are always present
+var recordFields, requiredRecordFields = jsonFieldNames(reflect.TypeOf(LogRecord{}))
+
+// Decodes the value of a LogRecord field by the JSON name of the field
+var fieldDecoders = make(map[string]func(*jlexer.Lexer, *LogRecord))
+
+func init() {
+	// The timestamp is only omitted by JSONFormater when it is renamed
+	requiredRecordFields["timestamp"] = true
+
+	t := reflect.TypeOf(LogRecord{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldDecoders[name] = fieldDecoder(i, t.Field(i).Type)
+	}
+}
+
+var numberType = reflect.TypeOf(Number(0))
+
+// Returns a decoder for the field of LogRecord with the index and type
+func fieldDecoder(index int, t reflect.Type) func(*jlexer.Lexer, *LogRecord) {
+	field := func(rec *LogRecord) reflect.Value {
+		return reflect.ValueOf(rec).Elem().Field(index)
+	}
+	switch {
+	case t == numberType:
+		return func(in *jlexer.Lexer, rec *LogRecord) {
+			field(rec).Addr().Interface().(*Number).UnmarshalEasyJSON(in)
+		}
+	case t.Kind() == reflect.String:
+		return func(in *jlexer.Lexer, rec *LogRecord) {
+			field(rec).SetString(in.String())
+		}
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		return func(in *jlexer.Lexer, rec *LogRecord) {
+			field(rec).SetInt(in.Int64())
+		}
+	case t.Kind() == reflect.Map:
+		return func(in *jlexer.Lexer, rec *LogRecord) {
+			m, ok := in.Interface().(map[string]interface{})
+			if !ok && in.Ok() {
+				in.AddError(errors.New("expected an object"))
+				return
+			}
+			field(rec).Set(reflect.ValueOf(m))
+		}
+	default:
+		// The exception chain and stack are rare, decode them with encoding/json
+		return func(in *jlexer.Lexer, rec *LogRecord) {
+			in.AddError(json.Unmarshal(in.Raw(), field(rec).Addr().Interface()))
+		}
+	}
+}
+
+// ParseRecord parses a record sent by the hooks in this repo. The buffer can
+// be a JSON record, or an udplog datagram in the `<category>:<json>` format
+// in which case the category of the record defaults to the prefix.
+//
+// Parsing is lenient; unknown fields and fields with an unexpected type are
+// placed in the context of the record and the record is not validated.
+func ParseRecord(buf []byte) (*LogRecord, error) {
+	return ParseRecordWithOptions(buf, ParseOptions{})
+}
+
+// ParseRecordStrict parses a record like ParseRecord. Unknown fields, fields
+// with an unexpected type or missing required fields are errors and the
+// record must pass Validate()
+func ParseRecordStrict(buf []byte) (*LogRecord, error) {
+	return ParseRecordWithOptions(buf, ParseOptions{Strict: true})
+}
+
+// ParseOptions control how ParseRecordWithOptions parses a record
+type ParseOptions struct {
+	// Unknown fields, fields with an unexpected type or missing required
+	// fields are errors and the record must pass Validate()
+	Strict bool
+
+	// The name of the timestamp field, the JSONFormater.TimestampFieldName
+	// of the formatter that wrote the record. Defaults to `timestamp`
+	TimestampFieldName string
+}
+
+// ParseRecordWithOptions parses a record like ParseRecord with the given options
+func ParseRecordWithOptions(buf []byte, opts ParseOptions) (*LogRecord, error) {
+	return parseRecord(buf, opts)
+}
+
+// Given a record in the `<prefix>:<json>` format return the prefix and the
+// JSON, if there is no prefix the buffer is returned unchanged
+func SplitPrefix(buf []byte) (string, []byte) {
+	buf = bytes.TrimSpace(buf)
+	idx := bytes.IndexByte(buf, ':')
+	if idx <= 0 || buf[0] == '{' {
+		return "", buf
+	}
+	for _, c := range buf[:idx] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '_' || c == '-' || c == '.') {
+			return "", buf
+		}
+	}
+	return string(buf[:idx]), bytes.TrimSpace(buf[idx+1:])
+}
+
+func parseRecord(buf []byte, opts ParseOptions) (*LogRecord, error) {
+	prefix, buf := SplitPrefix(buf)
+
+	var rec LogRecord
+	var extra map[string]interface{}
+	var seen map[string]bool
+	if opts.Strict {
+		seen = make(map[string]bool)
+	}
+	in := jlexer.Lexer{Data: buf}
+
+	in.Delim('{')
+	for in.Ok() && !in.IsDelim('}') {
+		key := in.String()
+		in.WantColon()
+		value := in.Raw()
+		in.WantComma()
+		if !in.Ok() {
+			break
+		}
+
+		name := key
+		if opts.TimestampFieldName != "" && key == opts.TimestampFieldName {
+			name = "timestamp"
+		}
+		if seen != nil {
+			seen[name] = true
+		}
+
+		if decode, ok := fieldDecoders[name]; ok {
+			// Decode the value directly into the field of the record
+			l := jlexer.Lexer{Data: value}
+			if l.IsNull() {
+				continue
+			}
+			decode(&l, &rec)
+			l.Consumed()
+			err := l.Error()
+			if err == nil {
+				continue
+			}
+			if opts.Strict {
+				return nil, errors.Wrapf(err, "invalid field '%s'", key)
+			}
+		} else if opts.Strict {
+			return nil, fmt.Errorf("unknown field '%s'", key)
+		}
+
+		// Preserve unknown and invalid fields in the context
+		l := jlexer.Lexer{Data: value}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[key] = l.Interface()
+	}
+	in.Delim('}')
+	in.Consumed()
+	if err := in.Error(); err != nil {
+		return nil, errors.Wrap(err, "while parsing record")
+	}
+
+	for k, v := range extra {
+		if rec.Context == nil {
+			rec.Context = make(map[string]interface{})
+		}
+		if _, exists := rec.Context[k]; !exists {
+			rec.Context[k] = v
+		}
+	}
+	if rec.Category == "" {
+		rec.Category = prefix
+	}
+
+	if opts.Strict {
+		for key := range requiredRecordFields {
+			if !seen[key] {
+				return nil, fmt.Errorf("missing field '%s'", key)
+			}
+		}
+		if err := rec.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+// Validate returns an error if the record is missing the app name or host
+// name, has an unknown log level or an implausible timestamp
+func (r *LogRecord) Validate() error {
+	if r.AppName == "" {
+		return errors.New("appname is empty")
+	}
+	if r.HostName == "" {
+		return errors.New("hostname is empty")
+	}
+	if _, err := logrus.ParseLevel(strings.ToLower(r.LogLevel)); err != nil {
+		return fmt.Errorf("unknown logLevel '%s'", r.LogLevel)
+	}
+	ts := r.Timestamp.Time()
+	if ts.Before(MinRecordTime) {
+		return fmt.Errorf("timestamp '%s' is before '%s'",
+			ts.Format(time.RFC3339), MinRecordTime.Format(time.RFC3339))
+	}
+	if ts.After(time.Now().Add(MaxRecordClockSkew)) {
+		return fmt.Errorf("timestamp '%s' is in the future", ts.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Returns the JSON field names of the struct, and the names of the fields
+// which are not `omitempty`
+func jsonFieldNames(t reflect.Type) (map[string]bool, map[string]bool) {
+	all := make(map[string]bool)
+	required := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		all[parts[0]] = true
+		if len(parts) == 1 || parts[1] != "omitempty" {
+			required[parts[0]] = true
+		}
+	}
+	return all, required
+}
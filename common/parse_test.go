@@ -0,0 +1,120 @@
+package common_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+const validRecord = `{"context":{"domain":"example.com"},"category":"logrus","appname":"parse.test",` +
+	`"hostname":"localhost","logLevel":"INFO","filename":"/src/main.go","funcName":"main.main",` +
+	`"lineno":10,"message":"hello","timestamp":1485482245.473685,"tid":"foo"}`
+
+func (s *CommonTestSuite) TestParseRecord(c *C) {
+	for i, tc := range []struct {
+		data     string
+		category string
+	}{
+		0: {data: validRecord, category: "logrus"},
+		1: {data: "logrus:" + validRecord + "\n", category: "logrus"},
+		// The prefix is the category if the record has none
+		2: {data: "udplog:" + validRecord[:len(validRecord)-1] + `,"category":""}`, category: "udplog"},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+
+		for _, parse := range []func([]byte) (*common.LogRecord, error){
+			common.ParseRecord, common.ParseRecordStrict} {
+			rec, err := parse([]byte(tc.data))
+			c.Assert(err, IsNil)
+			c.Assert(rec.Category, Equals, tc.category)
+			c.Assert(rec.Message, Equals, "hello")
+			c.Assert(rec.LineNo, Equals, 10)
+			c.Assert(rec.TID, Equals, "foo")
+			c.Assert(rec.Context["domain"], Equals, "example.com")
+			c.Assert(rec.Timestamp.Time().Equal(time.Unix(1485482245, 473685000)), Equals, true)
+		}
+	}
+}
+
+func (s *CommonTestSuite) TestParseRecordLenient(c *C) {
+	data := `logrus:{"appname":"parse.test","lineno":"ten","message":"hello","custom":{"a":1}}`
+
+	// Unknown and invalid fields are kept in the context
+	rec, err := common.ParseRecord([]byte(data))
+	c.Assert(err, IsNil)
+	c.Assert(rec.AppName, Equals, "parse.test")
+	c.Assert(rec.LineNo, Equals, 0)
+	c.Assert(rec.Context["lineno"], Equals, "ten")
+	c.Assert(rec.Context["custom"], DeepEquals, map[string]interface{}{"a": float64(1)})
+
+	_, err = common.ParseRecord([]byte(`logrus:{"appname":`))
+	c.Assert(err, NotNil)
+}
+
+func (s *CommonTestSuite) TestParseRecordStrict(c *C) {
+	future := time.Now().Add(48 * time.Hour).Unix()
+
+	for i, tc := range []struct {
+		data string
+		err  string
+	}{
+		0: {data: validRecord[:len(validRecord)-1] + `,"custom":1}`, err: "unknown field 'custom'"},
+		1: {data: validRecord[:len(validRecord)-1] + `,"lineno":"ten"}`, err: "invalid field 'lineno'.*"},
+		2: {data: `{"appname":"parse.test"}`, err: "missing field '.*'"},
+		3: {data: strings.Replace(validRecord, `"localhost"`, `""`, 1), err: "hostname is empty"},
+		4: {data: validRecord[:len(validRecord)-1] + `,"logLevel":"LOUD"}`, err: "unknown logLevel 'LOUD'"},
+		5: {data: validRecord[:len(validRecord)-1] + `,"timestamp":10}`, err: "timestamp '1970-.*' is before '2000-.*'"},
+		6: {data: validRecord[:len(validRecord)-1] + fmt.Sprintf(`,"timestamp":%d}`, future), err: "timestamp '.*' is in the future"},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+
+		_, err := common.ParseRecordStrict([]byte(tc.data))
+		c.Assert(err, ErrorMatches, tc.err)
+	}
+}
+
+func (s *CommonTestSuite) TestParseRecordTimestampFieldName(c *C) {
+	f := common.NewJSONFormater()
+	f.TimestampFieldName = "@timestamp"
+	f.TimestampFormat = common.TimestampRFC3339Nano
+	f.CaptureStack = true
+	var out bytes.Buffer
+	log := logrus.New()
+	log.Out = &out
+	log.Formatter = f
+	ts := time.Date(2021, 6, 1, 12, 0, 0, 500000000, time.UTC)
+	log.WithTime(ts).WithError(errors.New("bar")).Error("hello")
+	buf := out.Bytes()
+
+	// The renamed timestamp is an unknown field and the timestamp is missing
+	_, err := common.ParseRecordStrict(buf)
+	c.Assert(err, ErrorMatches, "unknown field '@timestamp'")
+
+	rec, err := common.ParseRecordWithOptions(buf, common.ParseOptions{
+		Strict:             true,
+		TimestampFieldName: "@timestamp",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "hello")
+	c.Assert(rec.Timestamp.Time().Equal(ts), Equals, true)
+	c.Assert(rec.ExcValue, Equals, "bar")
+	c.Assert(len(rec.Stack) > 0, Equals, true)
+	c.Assert(rec.Context["@timestamp"], IsNil)
+}
+
+func BenchmarkParseRecord(b *testing.B) {
+	data := []byte(validRecord)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := common.ParseRecord(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"bytes"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// The heap size recorded by JSONFormater.CaptureHeapAlloc is sampled at most
+// once per interval, as runtime.ReadMemStats() stops the world. Change it
+// before logging.
+var HeapSampleInterval = time.Second
+
+// Returns the ID of the calling goroutine as printed in its stack trace. The
+// go runtime does not expose the ID, so it is parsed from the header of
+// runtime.Stack() ie `goroutine 18 [running]:`. Returns 0 if it can not be
+// parsed. Formatting the stack is the most expensive of the runtime fields,
+// see BenchmarkRecordGoroutineID.
+func goroutineID() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	b := buf[:n]
+	if !bytes.HasPrefix(b, goroutinePrefix) {
+		return 0
+	}
+	var id int64
+	for _, c := range b[len(goroutinePrefix):] {
+		if c == ' ' {
+			return id
+		}
+		if c < '0' || c > '9' {
+			return 0
+		}
+		id = id*10 + int64(c-'0')
+	}
+	return 0
+}
+
+var goroutinePrefix = []byte("goroutine ")
+
+var heapSample struct {
+	sampledAt int64
+	alloc     int64
+}
+
+// Returns the bytes of allocated heap objects sampled at most once per
+// HeapSampleInterval
+func heapAlloc() int64 {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&heapSample.sampledAt)
+	// Only the goroutine which wins the swap samples, others use the previous sample
+	if now-last >= int64(HeapSampleInterval) && atomic.CompareAndSwapInt64(&heapSample.sampledAt, last, now) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		atomic.StoreInt64(&heapSample.alloc, int64(stats.HeapAlloc))
+	}
+	return atomic.LoadInt64(&heapSample.alloc)
+}
@@ -0,0 +1,93 @@
+package common_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CommonTestSuite) TestRuntimeFields(c *C) {
+	f := common.NewJSONFormater()
+	log := logrus.New()
+
+	// The runtime fields are opt-in
+	rec := f.Record(logrus.NewEntry(log))
+	c.Assert(rec.GoroutineID, Equals, int64(0))
+	c.Assert(rec.NumGoroutine, Equals, 0)
+	c.Assert(rec.HeapAlloc, Equals, int64(0))
+
+	f.CaptureGoroutineID = true
+	f.CaptureNumGoroutine = true
+	f.CaptureHeapAlloc = true
+	rec = f.Record(logrus.NewEntry(log))
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	c.Assert(strings.HasPrefix(string(buf), fmt.Sprintf("goroutine %d [", rec.GoroutineID)), Equals, true)
+	c.Assert(rec.NumGoroutine > 0, Equals, true)
+	c.Assert(rec.HeapAlloc > 0, Equals, true)
+
+	// Every goroutine has its own ID
+	var wg sync.WaitGroup
+	ids := make([]int64, 2)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			ids[i] = f.Record(logrus.NewEntry(log)).GoroutineID
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(ids[0], Not(Equals), ids[1])
+	c.Assert(ids[0], Not(Equals), rec.GoroutineID)
+
+	out, err := f.Format(logrus.NewEntry(log))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Matches, `.*"goroutineId":\d+,"numGoroutine":\d+,"heapAlloc":\d+.*\n`)
+}
+
+func benchmarkRecord(b *testing.B, f *common.JSONFormater) {
+	entry := logrus.NewEntry(logrus.New())
+	entry.Message = "benchmark"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Record(entry)
+	}
+}
+
+func BenchmarkRecord(b *testing.B) {
+	benchmarkRecord(b, common.NewJSONFormater())
+}
+
+func BenchmarkRecordGoroutineID(b *testing.B) {
+	f := common.NewJSONFormater()
+	f.CaptureGoroutineID = true
+	benchmarkRecord(b, f)
+}
+
+func BenchmarkRecordNumGoroutine(b *testing.B) {
+	f := common.NewJSONFormater()
+	f.CaptureNumGoroutine = true
+	benchmarkRecord(b, f)
+}
+
+func BenchmarkRecordHeapAlloc(b *testing.B) {
+	f := common.NewJSONFormater()
+	f.CaptureHeapAlloc = true
+	benchmarkRecord(b, f)
+}
+
+// The cost of sampling the heap size for every record
+func BenchmarkReadMemStats(b *testing.B) {
+	var stats runtime.MemStats
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		runtime.ReadMemStats(&stats)
+	}
+}
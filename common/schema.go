@@ -0,0 +1,310 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The version of the Elastic Common Schema produced by RecordToECS()
+const ECSVersion = "1.12.0"
+
+// ECSFormatter formats entries as Elastic Common Schema JSON documents. The
+// embedded JSONFormater extracts the LogRecord and holds its options.
+type ECSFormatter struct {
+	JSONFormater
+}
+
+func NewECSFormatter() *ECSFormatter {
+	return &ECSFormatter{JSONFormater: *NewJSONFormater()}
+}
+
+func (f *ECSFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return marshalLine(RecordToECS(f.Record(entry)))
+}
+
+// GELFFormatter formats entries as GELF 1.1 messages. The embedded
+// JSONFormater extracts the LogRecord and holds its options.
+type GELFFormatter struct {
+	JSONFormater
+}
+
+func NewGELFFormatter() *GELFFormatter {
+	return &GELFFormatter{JSONFormater: *NewJSONFormater()}
+}
+
+func (f *GELFFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return marshalLine(RecordToGELF(f.Record(entry)))
+}
+
+// OTelFormatter formats entries using the OpenTelemetry log data model. The
+// embedded JSONFormater extracts the LogRecord and holds its options.
+type OTelFormatter struct {
+	JSONFormater
+}
+
+func NewOTelFormatter() *OTelFormatter {
+	return &OTelFormatter{JSONFormater: *NewJSONFormater()}
+}
+
+func (f *OTelFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return marshalLine(RecordToOTel(f.Record(entry)))
+}
+
+// Given a LogRecord return a map in the Elastic Common Schema format as
+// described by https://www.elastic.co/guide/en/ecs-logging/overview/current/intro.html
+// The record context is placed in the custom `context` object.
+func RecordToECS(rec *LogRecord) map[string]interface{} {
+	result := map[string]interface{}{
+		"@timestamp":           rec.Timestamp.Time().UTC().Format(time.RFC3339Nano),
+		"ecs.version":          ECSVersion,
+		"log.level":            strings.ToLower(rec.LogLevel),
+		"log.logger":           rec.Category,
+		"log.origin.file.name": rec.FileName,
+		"log.origin.file.line": rec.LineNo,
+		"log.origin.function":  rec.FuncName,
+		"message":              rec.Message,
+		"service.name":         rec.AppName,
+		"host.hostname":        rec.HostName,
+	}
+	setNotEmpty(result, "process.pid", rec.PID)
+	setNotEmpty(result, "container.id", rec.CID)
+	setNotEmpty(result, "container.name", rec.ContainerName)
+	setNotEmpty(result, "kubernetes.pod.name", rec.PodName)
+	setNotEmpty(result, "kubernetes.namespace", rec.PodNamespace)
+	setNotEmpty(result, "kubernetes.node.name", rec.NodeName)
+	setNotEmpty(result, "trace.id", rec.TID)
+	setNotEmpty(result, "span.id", rec.SpanID)
+	setNotEmpty(result, "http.request.id", rec.RequestID)
+	setNotEmpty(result, "user.id", rec.UserID)
+	setNotEmpty(result, "organization.id", rec.TenantID)
+	setNotEmpty(result, "labels.parent_span_id", rec.ParentSpanID)
+	setNotEmpty(result, "labels.session_id", rec.SessionID)
+	setNotEmpty(result, "go.goroutine.id", rec.GoroutineID)
+	setNotEmpty(result, "go.goroutine.count", rec.NumGoroutine)
+	setNotEmpty(result, "go.heap.alloc", rec.HeapAlloc)
+	setNotEmpty(result, "error.type", rec.ExcType)
+	setNotEmpty(result, "error.message", rec.ExcValue)
+	setNotEmpty(result, "error.stack_trace", recordStackTrace(rec))
+	if len(rec.Context) != 0 {
+		result["context"] = rec.Context
+	}
+	return result
+}
+
+// Given a LogRecord return a map in the GELF 1.1 format as described by
+// https://docs.graylog.org/en/latest/pages/gelf.html
+// The record context is flattened into additional fields, nested keys are
+// joined with a `.`
+func RecordToGELF(rec *LogRecord) map[string]interface{} {
+	result := map[string]interface{}{
+		"version":       "1.1",
+		"host":          rec.HostName,
+		"short_message": rec.Message,
+		"timestamp":     json.Number(strconv.FormatFloat(float64(rec.Timestamp), 'f', 3, 64)),
+		"level":         SyslogSeverity(recordLevel(rec)),
+	}
+	setNotEmpty(result, "full_message", recordStackTrace(rec))
+
+	for k, v := range FlattenMap(rec.Context, ".") {
+		// `_id` is reserved by GELF
+		if k == "id" {
+			k = "_id"
+		}
+		switch v.(type) {
+		case string, json.Number, int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64, float32, float64:
+			result["_"+k] = v
+		default:
+			result["_"+k] = fmt.Sprint(v)
+		}
+	}
+
+	// Record fields have precedence over the context
+	result["_appname"] = rec.AppName
+	result["_category"] = rec.Category
+	result["_logLevel"] = rec.LogLevel
+	result["_filename"] = rec.FileName
+	result["_funcName"] = rec.FuncName
+	result["_lineno"] = rec.LineNo
+	setNotEmpty(result, "_pid", rec.PID)
+	setNotEmpty(result, "_cid", rec.CID)
+	setNotEmpty(result, "_podName", rec.PodName)
+	setNotEmpty(result, "_podNamespace", rec.PodNamespace)
+	setNotEmpty(result, "_nodeName", rec.NodeName)
+	setNotEmpty(result, "_containerName", rec.ContainerName)
+	setNotEmpty(result, "_tid", rec.TID)
+	setNotEmpty(result, "_spanId", rec.SpanID)
+	setNotEmpty(result, "_traceFlags", rec.TraceFlags)
+	setNotEmpty(result, "_parentSpanId", rec.ParentSpanID)
+	setNotEmpty(result, "_requestId", rec.RequestID)
+	setNotEmpty(result, "_sessionId", rec.SessionID)
+	setNotEmpty(result, "_userId", rec.UserID)
+	setNotEmpty(result, "_tenantId", rec.TenantID)
+	setNotEmpty(result, "_goroutineId", rec.GoroutineID)
+	setNotEmpty(result, "_numGoroutine", rec.NumGoroutine)
+	setNotEmpty(result, "_heapAlloc", rec.HeapAlloc)
+	setNotEmpty(result, "_excType", rec.ExcType)
+	setNotEmpty(result, "_excValue", rec.ExcValue)
+	return result
+}
+
+// Given a LogRecord return a map in the OpenTelemetry log data model as
+// described by https://opentelemetry.io/docs/reference/specification/logs/data-model/
+// The record context is flattened into attributes, nested keys are joined
+// with a `.`
+func RecordToOTel(rec *LogRecord) map[string]interface{} {
+	resource := map[string]interface{}{
+		"service.name": rec.AppName,
+		"host.name":    rec.HostName,
+	}
+	setNotEmpty(resource, "process.pid", rec.PID)
+	setNotEmpty(resource, "container.id", rec.CID)
+	setNotEmpty(resource, "k8s.pod.name", rec.PodName)
+	setNotEmpty(resource, "k8s.namespace.name", rec.PodNamespace)
+	setNotEmpty(resource, "k8s.node.name", rec.NodeName)
+	setNotEmpty(resource, "k8s.container.name", rec.ContainerName)
+
+	attributes := FlattenMap(rec.Context, ".")
+	attributes["code.filepath"] = rec.FileName
+	attributes["code.function"] = rec.FuncName
+	attributes["code.lineno"] = rec.LineNo
+	setNotEmpty(attributes, "log.category", rec.Category)
+	setNotEmpty(attributes, "exception.type", rec.ExcType)
+	setNotEmpty(attributes, "exception.message", rec.ExcValue)
+	setNotEmpty(attributes, "exception.stacktrace", recordStackTrace(rec))
+	setNotEmpty(attributes, "parent_span.id", rec.ParentSpanID)
+	setNotEmpty(attributes, "request.id", rec.RequestID)
+	setNotEmpty(attributes, "session.id", rec.SessionID)
+	setNotEmpty(attributes, "enduser.id", rec.UserID)
+	setNotEmpty(attributes, "tenant.id", rec.TenantID)
+	setNotEmpty(attributes, "go.goroutine.id", rec.GoroutineID)
+	setNotEmpty(attributes, "go.goroutine.count", rec.NumGoroutine)
+	setNotEmpty(attributes, "go.heap.alloc", rec.HeapAlloc)
+
+	result := map[string]interface{}{
+		"Timestamp":      rec.Timestamp.Time().UnixNano(),
+		"SeverityText":   rec.LogLevel,
+		"SeverityNumber": OTelSeverity(recordLevel(rec)),
+		"Body":           rec.Message,
+		"Resource":       resource,
+		"Attributes":     attributes,
+	}
+	setNotEmpty(result, "TraceId", rec.TID)
+	setNotEmpty(result, "SpanId", rec.SpanID)
+	if flags, err := strconv.ParseUint(rec.TraceFlags, 16, 8); err == nil {
+		result["TraceFlags"] = flags
+	}
+	return result
+}
+
+// Returns the syslog severity as defined by RFC 5424 for the logrus level
+func SyslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0 // Emergency
+	case logrus.FatalLevel:
+		return 2 // Critical
+	case logrus.ErrorLevel:
+		return 3 // Error
+	case logrus.WarnLevel:
+		return 4 // Warning
+	case logrus.InfoLevel:
+		return 6 // Informational
+	}
+	return 7 // Debug
+}
+
+// Returns the OpenTelemetry severity number for the logrus level
+func OTelSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 24 // FATAL4
+	case logrus.FatalLevel:
+		return 21 // FATAL
+	case logrus.ErrorLevel:
+		return 17 // ERROR
+	case logrus.WarnLevel:
+		return 13 // WARN
+	case logrus.InfoLevel:
+		return 9 // INFO
+	case logrus.DebugLevel:
+		return 5 // DEBUG
+	}
+	return 1 // TRACE
+}
+
+// Given a nested map return a flat map where the keys of nested maps are
+// joined with the separator
+func FlattenMap(nested map[string]interface{}, sep string) map[string]interface{} {
+	result := make(map[string]interface{})
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if child, ok := v.(map[string]interface{}); ok {
+				flatten(prefix+k+sep, child)
+				continue
+			}
+			result[prefix+k] = v
+		}
+	}
+	flatten("", nested)
+	return result
+}
+
+// Returns the level of the record, records with an unknown level are
+// treated as info
+func recordLevel(rec *LogRecord) logrus.Level {
+	level, err := logrus.ParseLevel(strings.ToLower(rec.LogLevel))
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+// Returns the error text of the record, or the captured stack if the record
+// has no error
+func recordStackTrace(rec *LogRecord) string {
+	if rec.ExcText != "" || len(rec.Stack) == 0 {
+		return rec.ExcText
+	}
+
+	var buf bytes.Buffer
+	for _, frame := range rec.Stack {
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.FuncName, frame.FileName, frame.LineNo)
+	}
+	return buf.String()
+}
+
+// Sets the key only if the value is not the zero value of its type
+func setNotEmpty(dest map[string]interface{}, key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	case int64:
+		if v == 0 {
+			return
+		}
+	}
+	dest[key] = value
+}
+
+func marshalLine(v interface{}) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "while marshalling json")
+	}
+	return append(buf, byte(0x0a)), nil
+}
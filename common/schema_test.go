@@ -0,0 +1,118 @@
+package common_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+type SchemaTestSuite struct{}
+
+var _ = Suite(&SchemaTestSuite{})
+
+func goldenRecord() *common.LogRecord {
+	return &common.LogRecord{
+		Context: map[string]interface{}{
+			"account": "acme",
+			"id":      "5f1c",
+			"http": map[string]interface{}{
+				"method": "POST",
+				"status": 502,
+			},
+			"retry": true,
+		},
+		Category:      "logrus",
+		AppName:       "golden",
+		HostName:      "localhost",
+		LogLevel:      "ERROR",
+		FileName:      "/src/golden/main.go",
+		FuncName:      "main.handler",
+		LineNo:        42,
+		Message:       "upstream failed",
+		Timestamp:     common.TimeToNumber(time.Date(2017, 1, 27, 1, 57, 25, 473685000, time.UTC)),
+		CID:           "d2ce1c0c6b3a",
+		PID:           3252,
+		PodName:       "api-7d4b9c-x2x8q",
+		PodNamespace:  "prod",
+		NodeName:      "node-1",
+		ContainerName: "api",
+		GoroutineID:   18,
+		NumGoroutine:  42,
+		HeapAlloc:     4194304,
+		TID:           "0af7651916cd43dd8448eb211c80319c",
+		SpanID:        "b7ad6b7169203331",
+		TraceFlags:    "01",
+		ParentSpanID:  "53995c3f42cd8ad8",
+		RequestID:     "req-1",
+		SessionID:     "sess-1",
+		UserID:        "user-1",
+		TenantID:      "acme",
+		ExcType:       "*errors.fundamental",
+		ExcValue:      "upstream: timeout",
+		ExcText:       "upstream: timeout\nmain.handler\n\t/src/golden/main.go:40",
+	}
+}
+
+func assertGolden(c *C, name string, v interface{}) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	c.Assert(err, IsNil)
+	buf = append(buf, '\n')
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		c.Assert(ioutil.WriteFile(path, buf, 0644), IsNil)
+	}
+	golden, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, string(golden))
+}
+
+func (s *SchemaTestSuite) TestECSGolden(c *C) {
+	assertGolden(c, "ecs.golden", common.RecordToECS(goldenRecord()))
+}
+
+func (s *SchemaTestSuite) TestGELFGolden(c *C) {
+	assertGolden(c, "gelf.golden", common.RecordToGELF(goldenRecord()))
+}
+
+func (s *SchemaTestSuite) TestOTelGolden(c *C) {
+	assertGolden(c, "otel.golden", common.RecordToOTel(goldenRecord()))
+}
+
+func (s *SchemaTestSuite) TestSchemaFormatters(c *C) {
+	for _, tc := range []struct {
+		formatter logrus.Formatter
+		funcKey   string
+	}{
+		{formatter: common.NewECSFormatter(), funcKey: "log.origin.function"},
+		{formatter: common.NewGELFFormatter(), funcKey: "_funcName"},
+		{formatter: common.NewOTelFormatter(), funcKey: "Attributes"},
+	} {
+		var b bytes.Buffer
+		log := logrus.New()
+		log.SetOutput(&b)
+		log.SetFormatter(tc.formatter)
+
+		// When
+		log.WithField("http.method", "GET").Warn("Warn Called")
+
+		// Then
+		var result map[string]interface{}
+		c.Assert(json.Unmarshal(b.Bytes(), &result), IsNil)
+		funcName := result[tc.funcKey]
+		if attrs, ok := funcName.(map[string]interface{}); ok {
+			c.Assert(attrs["http.method"], Equals, "GET")
+			funcName = attrs["code.function"]
+		}
+		c.Assert(funcName, Equals, "common_test.(*SchemaTestSuite).TestSchemaFormatters")
+	}
+}
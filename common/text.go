@@ -0,0 +1,194 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogfmtFormatter formats entries as logfmt key=value pairs. The embedded
+// JSONFormater extracts the LogRecord and holds its options.
+type LogfmtFormatter struct {
+	JSONFormater
+}
+
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{JSONFormater: *NewJSONFormater()}
+}
+
+func (f *LogfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	rec := f.Record(entry)
+
+	var buf bytes.Buffer
+	appendKeyValue(&buf, "time", rec.Timestamp.Time().Format(time.RFC3339Nano))
+	appendKeyValue(&buf, "level", strings.ToLower(rec.LogLevel))
+	appendKeyValue(&buf, "msg", rec.Message)
+	appendRecordFields(&buf, rec)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// ConsoleFormatter formats entries as a single human readable line with the
+// level colored for the terminal. The embedded JSONFormater extracts the
+// LogRecord and holds its options.
+type ConsoleFormatter struct {
+	JSONFormater
+
+	// Disables the terminal colors
+	DisableColors bool
+	// Layout of the time, defaults to DefaultConsoleTimeLayout
+	TimeLayout string
+}
+
+// The time layout used by ConsoleFormatter when no TimeLayout is given
+const DefaultConsoleTimeLayout = "15:04:05.000"
+
+func NewConsoleFormatter() *ConsoleFormatter {
+	return &ConsoleFormatter{JSONFormater: *NewJSONFormater()}
+}
+
+func (f *ConsoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	rec := f.Record(entry)
+
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = DefaultConsoleTimeLayout
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(rec.Timestamp.Time().Format(layout))
+	buf.WriteByte(' ')
+	level := fmt.Sprintf("%-7s", rec.LogLevel)
+	if f.DisableColors {
+		buf.WriteString(level)
+	} else {
+		fmt.Fprintf(&buf, "\x1b[%dm%s\x1b[0m", levelColor(recordLevel(rec)), level)
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(rec.Message)
+	appendRecordFields(&buf, rec)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func levelColor(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return 31 // red
+	case logrus.WarnLevel:
+		return 33 // yellow
+	case logrus.InfoLevel:
+		return 36 // cyan
+	}
+	return 37 // gray
+}
+
+// Appends the caller, exc fields and the flattened context of the record
+func appendRecordFields(buf *bytes.Buffer, rec *LogRecord) {
+	if rec.FileName != "" {
+		appendKeyValue(buf, "caller", fmt.Sprintf("%s:%d", rec.FileName, rec.LineNo))
+		appendKeyValue(buf, "func", rec.FuncName)
+	}
+	appendKeyValue(buf, "appname", rec.AppName)
+	appendNotEmpty(buf, "category", rec.Category)
+	appendNotEmpty(buf, "cid", rec.CID)
+	appendNotEmpty(buf, "podName", rec.PodName)
+	appendNotEmpty(buf, "podNamespace", rec.PodNamespace)
+	appendNotEmpty(buf, "nodeName", rec.NodeName)
+	appendNotEmpty(buf, "containerName", rec.ContainerName)
+	if rec.PID != 0 {
+		appendKeyValue(buf, "pid", rec.PID)
+	}
+	appendNotEmpty(buf, "tid", rec.TID)
+	appendNotEmpty(buf, "spanId", rec.SpanID)
+	appendNotEmpty(buf, "traceFlags", rec.TraceFlags)
+	appendNotEmpty(buf, "parentSpanId", rec.ParentSpanID)
+	appendNotEmpty(buf, "requestId", rec.RequestID)
+	appendNotEmpty(buf, "sessionId", rec.SessionID)
+	appendNotEmpty(buf, "userId", rec.UserID)
+	appendNotEmpty(buf, "tenantId", rec.TenantID)
+	if rec.GoroutineID != 0 {
+		appendKeyValue(buf, "goroutineId", rec.GoroutineID)
+	}
+	if rec.NumGoroutine != 0 {
+		appendKeyValue(buf, "numGoroutine", rec.NumGoroutine)
+	}
+	if rec.HeapAlloc != 0 {
+		appendKeyValue(buf, "heapAlloc", rec.HeapAlloc)
+	}
+	appendNotEmpty(buf, "excType", rec.ExcType)
+	appendNotEmpty(buf, "excValue", rec.ExcValue)
+
+	context := FlattenMap(rec.Context, ".")
+	keys := make([]string, 0, len(context))
+	for k := range context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		appendKeyValue(buf, k, context[k])
+	}
+}
+
+func appendNotEmpty(buf *bytes.Buffer, key, value string) {
+	if value != "" {
+		appendKeyValue(buf, key, value)
+	}
+}
+
+func appendKeyValue(buf *bytes.Buffer, key string, value interface{}) {
+	if buf.Len() != 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(sanitizeKey(key))
+	buf.WriteByte('=')
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if needsQuoting(s) {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+// Keys can not be quoted, characters logfmt parsers do not accept in a key
+// are replaced with `_`
+func sanitizeKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	if !needsQuoting(key) {
+		return key
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
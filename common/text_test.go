@@ -0,0 +1,77 @@
+package common_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/mailgun/holster/v3/errors"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CommonTestSuite) TestLogfmtFormatter(c *C) {
+	var b bytes.Buffer
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(common.NewLogfmtFormatter())
+
+	// When
+	log.WithFields(logrus.Fields{
+		"http.method": "GET",
+		"domain":      "example.com",
+		"tid":         "foo",
+		"err":         errors.New("kaboom"),
+	}).Error("Error Called")
+
+	// Then
+	line := b.String()
+	c.Assert(strings.HasPrefix(line, "time="), Equals, true, Commentf(line))
+	c.Assert(strings.HasSuffix(line, " domain=example.com http.method=GET\n"), Equals, true, Commentf(line))
+	c.Assert(line, Matches, `.* level=error msg="Error Called" caller=.*/common/text_test.go:\d+ `+
+		`func=common_test.\(\*CommonTestSuite\).TestLogfmtFormatter .*\n`)
+	c.Assert(strings.Contains(line, " tid=foo excType=*errors.fundamental excValue=kaboom "), Equals, true, Commentf(line))
+}
+
+func (s *CommonTestSuite) TestLogfmtKeys(c *C) {
+	var b bytes.Buffer
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(common.NewLogfmtFormatter())
+
+	// When
+	log.WithFields(logrus.Fields{
+		"user name": "bob smith",
+		"a=b":       1,
+		`say "hi"`:  "hi",
+		"tab\tkey":  true,
+		"":          "empty",
+	}).Info("Info Called")
+
+	// Then
+	line := b.String()
+	c.Assert(strings.HasSuffix(line, ` _=empty a_b=1 say__hi_=hi tab_key=true user_name="bob smith"`+"\n"),
+		Equals, true, Commentf(line))
+}
+
+func (s *CommonTestSuite) TestConsoleFormatter(c *C) {
+	var b bytes.Buffer
+	f := common.NewConsoleFormatter()
+	f.TimeLayout = "15:04"
+
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(f)
+
+	// When
+	log.WithField("quote", `say "hi"`).Warn("Warn Called")
+
+	// Then
+	line := b.String()
+	c.Assert(line, Matches, "\\d\\d:\\d\\d \x1b\\[33mWARNING\x1b\\[0m Warn Called caller=.* quote=\"say \\\\\"hi\\\\\"\"\n")
+
+	b.Reset()
+	f.DisableColors = true
+	log.Info("Info Called")
+	c.Assert(b.String(), Matches, "\\d\\d:\\d\\d INFO    Info Called caller=.*\n")
+}
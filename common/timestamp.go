@@ -0,0 +1,118 @@
+package common
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/mailru/easyjson/jlexer"
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/pkg/errors"
+)
+
+// TimestampFormat selects how JSONFormater marshals the timestamp of a record
+type TimestampFormat int
+
+const (
+	// Seconds since the epoch as a float, this is the default
+	TimestampEpoch TimestampFormat = iota
+	// Milliseconds since the epoch as an integer
+	TimestampEpochMillis
+	// Microseconds since the epoch as an integer
+	TimestampEpochMicros
+	// Nanoseconds since the epoch as an integer
+	TimestampEpochNanos
+	// RFC3339 string with second precision
+	TimestampRFC3339
+	// RFC3339 string with nanosecond precision
+	TimestampRFC3339Nano
+)
+
+// The number of decimal places of the `timestamp` of a LogRecord, and of
+// TimestampEpoch when no precision is given
+const DefaultTimestampPrecision = 6
+
+// Returns the seconds since the epoch of the time
+func TimeToNumber(t time.Time) Number {
+	return Number(float64(t.UnixNano()) / 1000000000)
+}
+
+// Returns the time of seconds since the epoch. A float64 can not represent
+// seconds since the epoch beyond microsecond precision, the time is rounded
+// to the microsecond.
+func (n Number) Time() time.Time {
+	sec, frac := math.Modf(float64(n))
+	return time.Unix(int64(sec), int64(math.Round(frac*1000000))*1000)
+}
+
+func (n Number) MarshalEasyJSON(w *jwriter.Writer) {
+	var buf [32]byte
+	w.Buffer.AppendBytes(strconv.AppendFloat(buf[:0], float64(n), 'f', DefaultTimestampPrecision, 64))
+}
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	l := jlexer.Lexer{Data: data}
+	n.UnmarshalEasyJSON(&l)
+	return l.Error()
+}
+
+// UnmarshalEasyJSON accepts any of the formats JSONFormater can marshal the
+// timestamp in. Integer timestamps are assumed to be seconds, milliseconds,
+// microseconds or nanoseconds since the epoch depending on their magnitude.
+func (n *Number) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	value := string(l.JsonNumber())
+	if !l.Ok() {
+		return
+	}
+
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*n = TimeToNumber(timeFromInt(ts))
+		return
+	}
+	if ts, err := strconv.ParseFloat(value, 64); err == nil {
+		*n = Number(ts)
+		return
+	}
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		l.AddError(errors.Wrapf(err, "invalid timestamp '%s'", value))
+		return
+	}
+	*n = TimeToNumber(ts)
+}
+
+func timeFromInt(ts int64) time.Time {
+	abs := ts
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs >= 1e17:
+		return time.Unix(0, ts)
+	case abs >= 1e14:
+		return time.Unix(0, ts*int64(time.Microsecond))
+	case abs >= 1e11:
+		return time.Unix(0, ts*int64(time.Millisecond))
+	}
+	return time.Unix(ts, 0)
+}
+
+// Writes the time in the format. The precision is the number of decimal
+// places of TimestampEpoch.
+func writeTimestamp(w *jwriter.Writer, t time.Time, format TimestampFormat, precision int) {
+	switch format {
+	case TimestampEpochMillis:
+		w.Int64(t.UnixNano() / int64(time.Millisecond))
+	case TimestampEpochMicros:
+		w.Int64(t.UnixNano() / int64(time.Microsecond))
+	case TimestampEpochNanos:
+		w.Int64(t.UnixNano())
+	case TimestampRFC3339:
+		w.String(t.Format(time.RFC3339))
+	case TimestampRFC3339Nano:
+		w.String(t.Format(time.RFC3339Nano))
+	default:
+		var buf [32]byte
+		w.Buffer.AppendBytes(strconv.AppendFloat(buf[:0], float64(t.UnixNano())/1000000000, 'f', precision, 64))
+	}
+}
@@ -0,0 +1,114 @@
+package common_test
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CommonTestSuite) TestTimestampFormats(c *C) {
+	ts := time.Date(2017, 1, 27, 1, 57, 25, 473685123, time.UTC)
+
+	for i, tc := range []struct {
+		format    common.TimestampFormat
+		precision *int
+		expected  string
+	}{
+		0: {
+			format:   common.TimestampEpoch,
+			expected: `1485482245.473685`,
+		}, 1: {
+			format:    common.TimestampEpoch,
+			precision: intPtr(3),
+			expected:  `1485482245.474`,
+		}, 2: {
+			format:    common.TimestampEpoch,
+			precision: intPtr(0),
+			expected:  `1485482245`,
+		}, 3: {
+			format:   common.TimestampEpochMillis,
+			expected: `1485482245473`,
+		}, 4: {
+			format:   common.TimestampEpochMicros,
+			expected: `1485482245473685`,
+		}, 5: {
+			format:   common.TimestampEpochNanos,
+			expected: `1485482245473685123`,
+		}, 6: {
+			format:   common.TimestampRFC3339,
+			expected: `"2017-01-27T01:57:25Z"`,
+		}, 7: {
+			format:   common.TimestampRFC3339Nano,
+			expected: `"2017-01-27T01:57:25.473685123Z"`,
+		}} {
+		fmt.Printf("Test case #%d\n", i)
+
+		f := common.NewJSONFormater()
+		f.TimestampFormat = tc.format
+		f.TimestampPrecision = tc.precision
+		buf, err := f.Format(&logrus.Entry{Logger: logrus.New(), Time: ts})
+		c.Assert(err, IsNil)
+		c.Assert(string(buf), Matches, `\{.*,"timestamp":`+regexpQuote(tc.expected)+`[,}].*\n`)
+		c.Assert(bytes.Count(buf, []byte(`"timestamp"`)), Equals, 1)
+
+		// Every format can be read back
+		var rec common.LogRecord
+		c.Assert(rec.UnmarshalJSON(buf), IsNil)
+		c.Assert(rec.Timestamp.Time().Sub(ts) < time.Second, Equals, true)
+		c.Assert(rec.Timestamp.Time().Sub(ts) > -time.Second, Equals, true)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func regexpQuote(s string) string {
+	return string(bytes.Replace([]byte(s), []byte("."), []byte(`\.`), -1))
+}
+
+func (s *CommonTestSuite) TestTimestampDefault(c *C) {
+	ts := time.Date(2017, 1, 27, 1, 57, 25, 473685123, time.UTC)
+	buf, err := common.NewJSONFormater().Format(&logrus.Entry{Logger: logrus.New(), Time: ts, Message: "hello"})
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Matches, `.*"message":"hello","timestamp":1485482245\.473685,.*\n`)
+
+	// The zero value of the formatter keeps the output of previous versions
+	buf, err = (&common.JSONFormater{}).Format(&logrus.Entry{Logger: logrus.New(), Time: ts, Message: "hello"})
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, `{"category":"logrus","appname":"","hostname":"","logLevel":"PANIC",`+
+		`"filename":"","funcName":"","lineno":0,"message":"hello","timestamp":1485482245.473685}`+"\n")
+
+	// The record keeps the seconds since the epoch
+	rec := common.LogRecord{Timestamp: common.TimeToNumber(ts)}
+	c.Assert(rec.Timestamp.Time().Equal(ts.Round(time.Microsecond)), Equals, true)
+}
+
+func (s *CommonTestSuite) TestTimestampFieldName(c *C) {
+	var b bytes.Buffer
+	f := common.NewJSONFormater()
+	f.TimestampFormat = common.TimestampRFC3339Nano
+	f.TimestampFieldName = "@timestamp"
+
+	log := logrus.New()
+	log.SetOutput(&b)
+	log.SetFormatter(f)
+
+	// When
+	log.WithField("timestamp", "context field").Info("Info Called")
+
+	// Then
+	c.Assert(bytes.Contains(b.Bytes(), []byte(`"@timestamp":"`)), Equals, true, Commentf(b.String()))
+	c.Assert(bytes.Contains(b.Bytes(), []byte(`"context":{"timestamp":"context field"}`)), Equals, true, Commentf(b.String()))
+	c.Assert(bytes.Count(b.Bytes(), []byte(`timestamp"`)), Equals, 2, Commentf(b.String()))
+	c.Assert(bytes.HasSuffix(b.Bytes(), []byte("}\n")), Equals, true)
+
+	// Names of other record fields would be duplicated
+	f.TimestampFieldName = "message"
+	_, err := f.Format(logrus.NewEntry(log))
+	c.Assert(err, ErrorMatches, "timestamp field name 'message' is the name of a record field")
+}
@@ -0,0 +1,164 @@
+package deduphook
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/internal/summary"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DedupHook collapses identical records. The first record is forwarded to the
+// wrapped hook, the identical records which follow within the window are
+// counted and forwarded as a single summary record when the window ends. The
+// summary holds `repeat_count`, `first_seen` and `last_seen` fields which end
+// up in the context of the LogRecord. The `repeat_count` is the number of
+// records collapsed into the summary, it does not include the first record
+// which was forwarded, and `first_seen` is the time of that first record.
+type DedupHook struct {
+	hook    logrus.Hook
+	conf    Config
+	pending map[string]*window
+
+	// Sync stuff
+	mutex     sync.Mutex
+	summaries *summary.Forwarder
+}
+
+type Config struct {
+	// Records are identical when they have the same level, message, caller and
+	// values for these fields. Other fields are ignored.
+	Fields []string
+	// How long identical records are collapsed after the first, defaults to 10 seconds
+	Window time.Duration
+	// How often the summaries of the windows which ended are forwarded, defaults to 1 second
+	FlushInterval time.Duration
+}
+
+type window struct {
+	start time.Time
+	count int
+	// Time of the record which started the window
+	firstSeen time.Time
+	// Copy of the first collapsed record
+	first    *logrus.Entry
+	lastSeen time.Time
+}
+
+func New(hook logrus.Hook, conf Config) *DedupHook {
+	setter.SetDefault(&conf.Window, 10*time.Second)
+	setter.SetDefault(&conf.FlushInterval, time.Second)
+
+	h := DedupHook{
+		hook:    hook,
+		conf:    conf,
+		pending: make(map[string]*window),
+	}
+	h.summaries = summary.New("deduphook", hook, conf.FlushInterval, &h.mutex, h.collect)
+	return &h
+}
+
+// Levels returns the levels of the wrapped hook
+func (h *DedupHook) Levels() []logrus.Level {
+	return h.hook.Levels()
+}
+
+func (h *DedupHook) Fire(entry *logrus.Entry) error {
+	key := h.key(entry)
+
+	h.mutex.Lock()
+	if h.summaries.Closed() {
+		h.mutex.Unlock()
+		return errors.New("hook is closed")
+	}
+	now := clock.Now()
+	if w, ok := h.pending[key]; ok && now.Sub(w.start) < h.conf.Window {
+		if w.count == 0 {
+			w.first = common.CopyEntry(entry)
+		}
+		w.count++
+		w.lastSeen = entry.Time
+		h.mutex.Unlock()
+		return nil
+	}
+	// The summary of an ended window goes before the record which starts the next
+	var summary *logrus.Entry
+	if w, ok := h.pending[key]; ok && w.count != 0 {
+		summary = w.summary()
+	}
+	h.pending[key] = &window{start: now, firstSeen: entry.Time}
+	h.mutex.Unlock()
+
+	if summary != nil {
+		if err := h.hook.Fire(summary); err != nil {
+			return err
+		}
+	}
+	return h.hook.Fire(entry)
+}
+
+// Returns the key shared by identical records
+func (h *DedupHook) key(entry *logrus.Entry) string {
+	var file string
+	var line int
+	if entry.Caller != nil {
+		file, line = entry.Caller.File, entry.Caller.Line
+	} else {
+		caller := common.GetLogrusCaller()
+		file, line = caller.File, caller.LineNo
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s\x00%s:%d", entry.Level, entry.Message, file, line)
+	for _, name := range h.conf.Fields {
+		fmt.Fprintf(&b, "\x00%v", entry.Data[name])
+	}
+	return b.String()
+}
+
+// Returns the record forwarded for the collapsed records of the window
+func (w *window) summary() *logrus.Entry {
+	summary := w.first
+	summary.Data["repeat_count"] = w.count
+	summary.Data["first_seen"] = w.firstSeen.Format(time.RFC3339Nano)
+	summary.Data["last_seen"] = w.lastSeen.Format(time.RFC3339Nano)
+	summary.Time = w.lastSeen
+	return summary
+}
+
+// Flush forwards the summaries of every window, including the windows which
+// have not ended yet
+func (h *DedupHook) Flush() error {
+	return h.summaries.Flush()
+}
+
+// Returns the summaries of the windows which ended, or of every window
+func (h *DedupHook) collect(all bool) []*logrus.Entry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := clock.Now()
+	var summaries []*logrus.Entry
+	for key, w := range h.pending {
+		if !all && now.Sub(w.start) < h.conf.Window {
+			continue
+		}
+		delete(h.pending, key)
+		if w.count == 0 {
+			continue
+		}
+		summaries = append(summaries, w.summary())
+	}
+	return summaries
+}
+
+// Close forwards the pending summaries then closes the wrapped hook if it has
+// a `Close() error` method
+func (h *DedupHook) Close() error {
+	return h.summaries.Close()
+}
@@ -0,0 +1,207 @@
+package deduphook_test
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/logrus-hooks/deduphook"
+	"github.com/mailgun/logrus-hooks/udploghook"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DedupSuite struct{}
+
+var _ = Suite(&DedupSuite{})
+
+type fakeHook struct {
+	mutex   sync.Mutex
+	entries []*logrus.Entry
+	closed  bool
+}
+
+func (h *fakeHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fakeHook) Fire(entry *logrus.Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func (h *fakeHook) Close() error {
+	h.closed = true
+	return errors.New("kaboom")
+}
+
+func (h *fakeHook) Entries() []*logrus.Entry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]*logrus.Entry(nil), h.entries...)
+}
+
+func newLogger(hook logrus.Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	return logger
+}
+
+func (s *DedupSuite) TestCollapse(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	dh := deduphook.New(hook, deduphook.Config{Fields: []string{"account_id"}, Window: time.Minute, FlushInterval: time.Hour})
+	defer dh.Close()
+	logger := newLogger(dh)
+
+	for i := 0; i < 4; i++ {
+		// Fields missing from Config.Fields are ignored
+		logger.WithFields(logrus.Fields{"account_id": "acme", "attempt": i}).Error("boom")
+	}
+	// Records with a different field, level, message or caller are not identical
+	logger.WithField("account_id", "hooli").Error("boom")
+	logger.WithField("account_id", "acme").Warn("boom")
+	logger.WithField("account_id", "acme").Error("bang")
+	logger.WithField("account_id", "acme").Error("boom")
+
+	entries := hook.Entries()
+	c.Assert(entries, HasLen, 5)
+	c.Assert(entries[0].Data["attempt"], Equals, 0)
+
+	c.Assert(dh.Flush(), IsNil)
+	entries = hook.Entries()
+	c.Assert(entries, HasLen, 6)
+
+	// The summary is a copy of the first collapsed record
+	summary := entries[5]
+	c.Assert(summary.Message, Equals, "boom")
+	c.Assert(summary.Level, Equals, logrus.ErrorLevel)
+	c.Assert(summary.Data["attempt"], Equals, 1)
+	// The forwarded first record is not counted
+	c.Assert(summary.Data["repeat_count"], Equals, 3)
+	c.Assert(summary.Caller, NotNil)
+	c.Assert(summary.Caller.Function, Matches, ".*TestCollapse")
+
+	firstSeen, err := time.Parse(time.RFC3339Nano, summary.Data["first_seen"].(string))
+	c.Assert(err, IsNil)
+	lastSeen, err := time.Parse(time.RFC3339Nano, summary.Data["last_seen"].(string))
+	c.Assert(err, IsNil)
+	// The key was first seen with the forwarded record
+	c.Assert(firstSeen.Equal(entries[0].Time), Equals, true)
+	c.Assert(lastSeen.After(firstSeen), Equals, true)
+	c.Assert(summary.Time.Equal(lastSeen), Equals, true)
+
+	// The windows were flushed so the next record is forwarded
+	logger.WithField("account_id", "acme").Error("boom")
+	c.Assert(hook.Entries(), HasLen, 7)
+}
+
+func (s *DedupSuite) TestWindow(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	dh := deduphook.New(hook, deduphook.Config{Window: time.Minute, FlushInterval: time.Hour})
+	defer dh.Close()
+
+	fire := func() {
+		c.Assert(dh.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "boom", Time: time.Now()}), IsNil)
+	}
+
+	fire()
+	fire()
+	c.Assert(hook.Entries(), HasLen, 1)
+
+	// A record after the window is forwarded and starts a new window
+	clock.Advance(time.Minute)
+	fire()
+	fire()
+	fire()
+	// The summary of the first window was forwarded before the new record
+	entries := hook.Entries()
+	c.Assert(entries, HasLen, 3)
+	c.Assert(entries[1].Data["repeat_count"], Equals, 1)
+	c.Assert(entries[2].Data["repeat_count"], IsNil)
+
+	c.Assert(dh.Flush(), IsNil)
+	entries = hook.Entries()
+	c.Assert(entries, HasLen, 4)
+	c.Assert(entries[3].Data["repeat_count"], Equals, 2)
+}
+
+func (s *DedupSuite) TestTimer(c *C) {
+	hook := &fakeHook{}
+	dh := deduphook.New(hook, deduphook.Config{Window: 20 * time.Millisecond, FlushInterval: 10 * time.Millisecond})
+	defer dh.Close()
+	logger := newLogger(dh)
+
+	for i := 0; i < 3; i++ {
+		logger.Error("boom")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hook.Entries()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	entries := hook.Entries()
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[1].Data["repeat_count"], Equals, 2)
+}
+
+func (s *DedupSuite) TestClose(c *C) {
+	hook := &fakeHook{}
+	dh := deduphook.New(hook, deduphook.Config{Window: time.Hour})
+	logger := newLogger(dh)
+
+	for i := 0; i < 2; i++ {
+		logger.Error("boom")
+	}
+	logger.Info("no repeats")
+
+	// The pending summaries are sent before the wrapped hook is closed
+	c.Assert(dh.Close(), ErrorMatches, "kaboom")
+	c.Assert(hook.closed, Equals, true)
+	entries := hook.Entries()
+	c.Assert(entries, HasLen, 3)
+	c.Assert(entries[2].Data["repeat_count"], Equals, 1)
+
+	c.Assert(dh.Fire(&logrus.Entry{Level: logrus.ErrorLevel}), ErrorMatches, "hook is closed")
+	c.Assert(dh.Close(), IsNil)
+}
+
+func (s *DedupSuite) TestUDPHook(c *C) {
+	server, err := udploghook.NewServer("127.0.0.1", 0)
+	c.Assert(err, IsNil)
+	defer server.Close()
+
+	udp, err := udploghook.New(server.Host(), server.Port())
+	c.Assert(err, IsNil)
+	dh := deduphook.New(udp, deduphook.Config{Window: time.Hour})
+	logger := newLogger(dh)
+
+	for i := 0; i < 3; i++ {
+		logger.Error("boom")
+	}
+	c.Assert(dh.Close(), IsNil)
+
+	rec, err := server.GetRecord()
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "boom")
+	c.Assert(rec.Context, IsNil)
+
+	rec, err = server.GetRecord()
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "boom")
+	c.Assert(rec.FuncName, Equals, "deduphook_test.(*DedupSuite).TestUDPHook")
+	c.Assert(rec.Context["repeat_count"], Equals, float64(2))
+	c.Assert(rec.Context["first_seen"], NotNil)
+	c.Assert(rec.Context["last_seen"], NotNil)
+}
@@ -0,0 +1,358 @@
+package failoverhook
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowCounter is implemented by hooks which drop records when their
+// buffer is full, ie kafkahook, httphook and the udploghook stream hook
+type OverflowCounter interface {
+	Overflows() int64
+}
+
+// ErrorCounter is implemented by hooks which send records asynchronously and
+// count the records they failed to send, ie kafkahook
+type ErrorCounter interface {
+	Errors() int64
+}
+
+// FailoverHook sends each record to the first healthy hook in order of
+// preference. A hook becomes unhealthy when too many of its recent records
+// failed, when it drops records because its buffer overflowed or when it
+// fails to send records asynchronously. Unhealthy hooks are probed with a
+// record every ProbeInterval. A hook is used again when a probe succeeds and
+// the hook drops or fails to send no records for the next ProbeInterval, so
+// hooks which send asynchronously have time to report the probe failed.
+//
+// A record is sent to the next hook when the hook returns an error or drops
+// the record while it is fired. Records the hook fails to send after Fire()
+// returned are lost, and a record dropped by a concurrent Fire() might be
+// sent twice.
+type FailoverHook struct {
+	conf   Config
+	sinks  []*sink
+	levels []logrus.Level
+	mutex  sync.Mutex
+}
+
+type Config struct {
+	// The hooks in order of preference
+	Sinks []Sink
+	// Number of recent records the error rate of a hook is computed over, defaults to 10
+	WindowSize int
+	// Number of recent records required before the error rate is checked,
+	// defaults to 5 or WindowSize if smaller
+	MinSamples int
+	// A hook is unhealthy when the error rate of its recent records exceeds
+	// this rate, defaults to 0.5
+	MaxErrorRate float64
+	// A hook is unhealthy when it drops or fails to send this many records
+	// between two records, defaults to 1
+	MaxOverflows int64
+	// How often an unhealthy hook is probed, defaults to 10 seconds
+	ProbeInterval time.Duration
+}
+
+// Sink is a hook the records fail over between
+type Sink struct {
+	// The name of the sink in Status(), defaults to the index of the sink
+	Name string
+	Hook logrus.Hook
+}
+
+// Status reports the active sink and the health of every sink
+type Status struct {
+	// The name of the sink records are sent to, empty if every sink is unhealthy
+	Active string
+	Sinks  []SinkStatus
+}
+
+type SinkStatus struct {
+	Name      string
+	Healthy   bool
+	ErrorRate float64
+	Overflows int64
+	Errors    int64
+	LastError string
+	// When the sink was last probed while unhealthy
+	LastProbe time.Time
+	// True if the last probe succeeded, the sink is healthy again if it does
+	// not drop or fail to send records until the next ProbeInterval
+	Probing bool
+}
+
+type sink struct {
+	conf      Sink
+	levels    map[logrus.Level]bool
+	healthy   bool
+	results   []bool
+	next      int
+	overflows int64
+	errors    int64
+	lastError error
+	lastProbe time.Time
+	probing   bool
+}
+
+func New(conf Config) (*FailoverHook, error) {
+	if len(conf.Sinks) == 0 {
+		return nil, errors.New("at least one sink is required")
+	}
+	setter.SetDefault(&conf.WindowSize, 10)
+	setter.SetDefault(&conf.MinSamples, 5)
+	if conf.MinSamples > conf.WindowSize {
+		conf.MinSamples = conf.WindowSize
+	}
+	setter.SetDefault(&conf.MaxErrorRate, 0.5)
+	setter.SetDefault(&conf.MaxOverflows, int64(1))
+	setter.SetDefault(&conf.ProbeInterval, 10*time.Second)
+
+	h := FailoverHook{conf: conf}
+	union := make(map[logrus.Level]bool)
+	for i, sc := range conf.Sinks {
+		if sc.Hook == nil {
+			return nil, fmt.Errorf("sink %d has no hook", i)
+		}
+		setter.SetDefault(&sc.Name, strconv.Itoa(i))
+
+		s := &sink{
+			conf:    sc,
+			levels:  make(map[logrus.Level]bool),
+			healthy: true,
+		}
+		s.overflows, s.errors = s.counters()
+		for _, l := range sc.Hook.Levels() {
+			s.levels[l] = true
+			union[l] = true
+		}
+		h.sinks = append(h.sinks, s)
+	}
+
+	for l := range union {
+		h.levels = append(h.levels, l)
+	}
+	sort.Slice(h.levels, func(i, j int) bool { return h.levels[i] < h.levels[j] })
+	return &h, nil
+}
+
+func (h *FailoverHook) Fire(entry *logrus.Entry) error {
+	now := time.Now()
+	var errs []string
+	for _, s := range h.sinks {
+		if !s.levels[entry.Level] {
+			continue
+		}
+		ok, probe := h.available(s, now)
+		if !ok {
+			continue
+		}
+
+		// The hook is fired without holding the mutex
+		before, _ := s.counters()
+		err := s.conf.Hook.Fire(entry)
+		if overflows, _ := s.counters(); err == nil && overflows > before {
+			err = errors.Wrap(errOverflow, "dropped the record")
+		}
+		h.report(s, err, now, probe)
+		if err == nil {
+			return nil
+		}
+
+		// Fall through to the next sink
+		errs = append(errs, fmt.Sprintf("sink '%s': %s", s.conf.Name, err))
+	}
+
+	if len(errs) == 0 {
+		return errors.New("no healthy sink")
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+var (
+	errOverflow = errors.New("buffer overflow")
+	errSend     = errors.New("send error")
+)
+
+// Returns true if the record should be sent to the sink, and true if the
+// record is a probe. An unhealthy sink is only sent one record every
+// ProbeInterval, and recovers a ProbeInterval after a successful probe if it
+// did not drop or fail to send records since.
+func (h *FailoverHook) available(s *sink, now time.Time) (bool, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s.healthy {
+		return true, false
+	}
+	if now.Sub(s.lastProbe) < h.conf.ProbeInterval {
+		return false, false
+	}
+	s.lastProbe = now
+	if !s.probing {
+		return true, true
+	}
+
+	s.probing = false
+	if err := h.checkDropped(s); err != nil {
+		// The probe or the records before it failed after Fire() returned
+		s.lastError = err
+		_, _ = fmt.Fprintf(os.Stderr, "[failoverhook] sink '%s' probe failed: %s\n", s.conf.Name, err)
+		return false, false
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "[failoverhook] sink '%s' recovered\n", s.conf.Name)
+	s.healthy = true
+	s.results, s.next = s.results[:0], 0
+	return true, false
+}
+
+// Updates the health of the sink with the result of a record
+func (h *FailoverHook) report(s *sink, err error, now time.Time, probe bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// Records dropped or failed since the last record count against the
+	// sink, even if this record was accepted
+	dropped := h.checkDropped(s)
+	if err == nil {
+		err = dropped
+	}
+	if probe {
+		// The sink recovers if the counters stay flat until the next probe
+		if err != nil {
+			s.lastError = err
+		}
+		s.probing = err == nil
+		return
+	}
+	if err == nil {
+		s.record(true, h.conf.WindowSize)
+		return
+	}
+
+	s.lastError = err
+	s.record(false, h.conf.WindowSize)
+	if dropped != nil || (len(s.results) >= h.conf.MinSamples && s.errorRate() > h.conf.MaxErrorRate) {
+		h.markUnhealthy(s, now)
+	}
+}
+
+// Returns the overflows and errors counted by the hook of the sink
+func (s *sink) counters() (int64, int64) {
+	var overflows, errs int64
+	if counter, ok := s.conf.Hook.(OverflowCounter); ok {
+		overflows = counter.Overflows()
+	}
+	if counter, ok := s.conf.Hook.(ErrorCounter); ok {
+		errs = counter.Errors()
+	}
+	return overflows, errs
+}
+
+// Returns an error if the sink dropped or failed to send too many records
+// since the last check, the caller must hold the mutex
+func (h *FailoverHook) checkDropped(s *sink) error {
+	overflows, errs := s.counters()
+	dropped, failed := overflows-s.overflows, errs-s.errors
+	s.overflows, s.errors = overflows, errs
+	if dropped+failed < h.conf.MaxOverflows {
+		return nil
+	}
+	if failed == 0 {
+		return errors.Wrapf(errOverflow, "dropped %d records", dropped)
+	}
+	return errors.Wrapf(errSend, "failed to send %d records", failed)
+}
+
+func (h *FailoverHook) markUnhealthy(s *sink, now time.Time) {
+	if !s.healthy {
+		return
+	}
+	s.healthy = false
+	s.lastProbe = now
+	_, _ = fmt.Fprintf(os.Stderr, "[failoverhook] sink '%s' unhealthy: %s\n", s.conf.Name, s.lastError)
+}
+
+// Records the result of a record in the window of recent results
+func (s *sink) record(ok bool, size int) {
+	if len(s.results) < size {
+		s.results = append(s.results, ok)
+		return
+	}
+	s.results[s.next] = ok
+	s.next = (s.next + 1) % size
+}
+
+func (s *sink) errorRate() float64 {
+	if len(s.results) == 0 {
+		return 0
+	}
+	var failed int
+	for _, ok := range s.results {
+		if !ok {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(s.results))
+}
+
+// Status returns the active sink and the health of every sink
+func (h *FailoverHook) Status() Status {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var status Status
+	for _, s := range h.sinks {
+		if s.healthy && status.Active == "" {
+			status.Active = s.conf.Name
+		}
+		ss := SinkStatus{
+			Name:      s.conf.Name,
+			Healthy:   s.healthy,
+			ErrorRate: s.errorRate(),
+			Overflows: s.overflows,
+			Errors:    s.errors,
+		}
+		if s.lastError != nil {
+			ss.LastError = s.lastError.Error()
+		}
+		if !s.healthy {
+			ss.LastProbe = s.lastProbe
+			ss.Probing = s.probing
+		}
+		status.Sinks = append(status.Sinks, ss)
+	}
+	return status
+}
+
+// Levels returns every level accepted by at least one sink
+func (h *FailoverHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Close closes every hook which has a `Close() error` method. The errors of
+// the hooks are combined.
+func (h *FailoverHook) Close() error {
+	var msgs []string
+	for _, s := range h.sinks {
+		closer, ok := s.conf.Hook.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			msgs = append(msgs, fmt.Sprintf("sink '%s': %s", s.conf.Name, err))
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package failoverhook_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/failoverhook"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestFailoverHook(t *testing.T) { TestingT(t) }
+
+// Records the messages fired, fails while err is set and drops records
+// while overflow is set
+type testHook struct {
+	err       error
+	overflow  bool
+	overflows int64
+	errors    int64
+	block     chan struct{}
+	messages  []string
+	closed    bool
+}
+
+func (h *testHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *testHook) Fire(entry *logrus.Entry) error {
+	if h.block != nil {
+		<-h.block
+	}
+	if h.err != nil {
+		return h.err
+	}
+	if h.overflow {
+		h.overflows++
+		return nil
+	}
+	h.messages = append(h.messages, entry.Message)
+	return nil
+}
+
+func (h *testHook) Overflows() int64 { return h.overflows }
+
+func (h *testHook) Errors() int64 { return h.errors }
+
+func (h *testHook) Close() error {
+	h.closed = true
+	return nil
+}
+
+type FailoverHookTests struct {
+	primary   *testHook
+	secondary *testHook
+	hook      *failoverhook.FailoverHook
+	log       *logrus.Logger
+}
+
+var _ = Suite(&FailoverHookTests{})
+
+func (s *FailoverHookTests) SetUpTest(c *C) {
+	s.primary, s.secondary = &testHook{}, &testHook{}
+	var err error
+	s.hook, err = failoverhook.New(failoverhook.Config{
+		Sinks: []failoverhook.Sink{
+			{Name: "primary", Hook: s.primary},
+			{Name: "secondary", Hook: s.secondary},
+		},
+		// Check the error rate from the first record
+		MinSamples:    1,
+		ProbeInterval: 20 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+	s.log.Hooks.Add(s.hook)
+}
+
+func (s *FailoverHookTests) TestFailover(c *C) {
+	s.log.Info("one")
+	c.Assert(s.hook.Status().Active, Equals, "primary")
+
+	// The failed record is sent to the next sink
+	s.primary.err = errors.New("unavailable")
+	s.log.Info("two")
+	s.log.Info("three")
+
+	c.Assert(s.primary.messages, DeepEquals, []string{"one"})
+	c.Assert(s.secondary.messages, DeepEquals, []string{"two", "three"})
+
+	status := s.hook.Status()
+	c.Assert(status.Active, Equals, "secondary")
+	c.Assert(status.Sinks[0].Healthy, Equals, false)
+	c.Assert(status.Sinks[0].LastError, Equals, "unavailable")
+	c.Assert(status.Sinks[1].Healthy, Equals, true)
+}
+
+func (s *FailoverHookTests) TestProbe(c *C) {
+	s.primary.err = errors.New("unavailable")
+	s.log.Info("one")
+	c.Assert(s.hook.Status().Active, Equals, "secondary")
+
+	// A failed probe keeps the sink unhealthy
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("two")
+	c.Assert(s.hook.Status().Active, Equals, "secondary")
+	c.Assert(s.hook.Status().Sinks[0].Probing, Equals, false)
+
+	// The sink recovers but is only used again once probed
+	s.primary.err = nil
+	s.log.Info("three")
+	c.Assert(s.hook.Status().Active, Equals, "secondary")
+
+	// The probe succeeds, the sink is used again if it does not drop or fail
+	// to send records until the next probe
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("four")
+	s.log.Info("five")
+	c.Assert(s.hook.Status().Active, Equals, "secondary")
+	c.Assert(s.hook.Status().Sinks[0].Probing, Equals, true)
+
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("six")
+	c.Assert(s.hook.Status().Active, Equals, "primary")
+
+	c.Assert(s.primary.messages, DeepEquals, []string{"four", "six"})
+	c.Assert(s.secondary.messages, DeepEquals, []string{"one", "two", "three", "five"})
+}
+
+func (s *FailoverHookTests) TestProbeFailsLater(c *C) {
+	s.primary.overflows++
+	s.log.Info("one")
+	c.Assert(s.hook.Status().Active, Equals, "secondary")
+
+	// The probe is accepted but the hook fails to send it later, as kafkahook
+	// does when the brokers are down
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("two")
+	c.Assert(s.hook.Status().Sinks[0].Probing, Equals, true)
+	s.primary.errors++
+
+	// The sink stays unhealthy and is probed again after another interval
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("three")
+	status := s.hook.Status()
+	c.Assert(status.Active, Equals, "secondary")
+	c.Assert(status.Sinks[0].Probing, Equals, false)
+	c.Assert(status.Sinks[0].LastError, Equals, "failed to send 1 records: send error")
+
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("four")
+	time.Sleep(25 * time.Millisecond)
+	s.log.Info("five")
+	c.Assert(s.hook.Status().Active, Equals, "primary")
+	c.Assert(s.primary.messages, DeepEquals, []string{"one", "two", "four", "five"})
+	c.Assert(s.secondary.messages, DeepEquals, []string{"three"})
+}
+
+func (s *FailoverHookTests) TestMinSamples(c *C) {
+	hook, err := failoverhook.New(failoverhook.Config{
+		Sinks: []failoverhook.Sink{{Hook: s.primary}, {Hook: s.secondary}},
+	})
+	c.Assert(err, IsNil)
+	entry := logrus.NewEntry(s.log)
+
+	// The error rate is not checked before 5 records
+	s.primary.err = errors.New("unavailable")
+	for i := 0; i < 4; i++ {
+		c.Assert(hook.Fire(entry), IsNil)
+		c.Assert(hook.Status().Active, Equals, "0")
+	}
+	c.Assert(hook.Fire(entry), IsNil)
+	c.Assert(hook.Status().Active, Equals, "1")
+}
+
+func (s *FailoverHookTests) TestOverflow(c *C) {
+	s.primary.overflow = true
+	s.log.Info("one")
+	s.primary.overflow = false
+	s.log.Info("two")
+
+	status := s.hook.Status()
+	c.Assert(status.Active, Equals, "secondary")
+	c.Assert(status.Sinks[0].Overflows, Equals, int64(1))
+	c.Assert(status.Sinks[0].LastError, Equals, "dropped the record: buffer overflow")
+	c.Assert(s.secondary.messages, DeepEquals, []string{"one", "two"})
+}
+
+func (s *FailoverHookTests) TestOverflowBetweenRecords(c *C) {
+	s.log.Info("one")
+
+	// Records dropped outside of Fire() make the sink unhealthy, the record
+	// accepted by the sink is not sent again
+	s.primary.overflows++
+	s.log.Info("two")
+	s.log.Info("three")
+
+	c.Assert(s.primary.messages, DeepEquals, []string{"one", "two"})
+	c.Assert(s.secondary.messages, DeepEquals, []string{"three"})
+	status := s.hook.Status()
+	c.Assert(status.Active, Equals, "secondary")
+	c.Assert(status.Sinks[0].LastError, Equals, "dropped 1 records: buffer overflow")
+}
+
+func (s *FailoverHookTests) TestSendErrors(c *C) {
+	s.log.Info("one")
+
+	// The hook failed to send a record after Fire() returned
+	s.primary.errors++
+	s.log.Info("two")
+	s.log.Info("three")
+
+	c.Assert(s.primary.messages, DeepEquals, []string{"one", "two"})
+	c.Assert(s.secondary.messages, DeepEquals, []string{"three"})
+	status := s.hook.Status()
+	c.Assert(status.Active, Equals, "secondary")
+	c.Assert(status.Sinks[0].Errors, Equals, int64(1))
+	c.Assert(status.Sinks[0].LastError, Equals, "failed to send 1 records: send error")
+}
+
+func (s *FailoverHookTests) TestFireNotLocked(c *C) {
+	s.primary.block = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.log.Info("one")
+		close(done)
+	}()
+
+	// A slow hook does not block the status or other records
+	c.Assert(s.hook.Status().Active, Equals, "primary")
+	close(s.primary.block)
+	<-done
+	c.Assert(s.primary.messages, DeepEquals, []string{"one"})
+}
+
+func (s *FailoverHookTests) TestErrorRate(c *C) {
+	hook, err := failoverhook.New(failoverhook.Config{
+		Sinks:        []failoverhook.Sink{{Hook: s.primary}, {Hook: s.secondary}},
+		WindowSize:   4,
+		MaxErrorRate: 0.5,
+	})
+	c.Assert(err, IsNil)
+	entry := logrus.NewEntry(s.log)
+
+	for i := 0; i < 3; i++ {
+		c.Assert(hook.Fire(entry), IsNil)
+	}
+	// One error in the window of 4 is tolerated
+	s.primary.err = errors.New("unavailable")
+	c.Assert(hook.Fire(entry), IsNil)
+	c.Assert(hook.Status().Active, Equals, "0")
+	c.Assert(hook.Status().Sinks[0].ErrorRate, Equals, 0.25)
+
+	// Three errors are not
+	c.Assert(hook.Fire(entry), IsNil)
+	c.Assert(hook.Status().Active, Equals, "0")
+	c.Assert(hook.Fire(entry), IsNil)
+	c.Assert(hook.Status().Active, Equals, "1")
+	c.Assert(hook.Status().Sinks[0].ErrorRate, Equals, 0.75)
+}
+
+func (s *FailoverHookTests) TestAllFailed(c *C) {
+	s.primary.err = errors.New("unavailable")
+	s.secondary.err = errors.New("down")
+
+	err := s.hook.Fire(logrus.NewEntry(s.log))
+	c.Assert(err, ErrorMatches, "sink 'primary': unavailable; sink 'secondary': down")
+	c.Assert(s.hook.Status().Active, Equals, "")
+
+	err = s.hook.Fire(logrus.NewEntry(s.log))
+	c.Assert(err, ErrorMatches, "no healthy sink")
+}
+
+func (s *FailoverHookTests) TestClose(c *C) {
+	c.Assert(s.hook.Close(), IsNil)
+	c.Assert(s.primary.closed, Equals, true)
+	c.Assert(s.secondary.closed, Equals, true)
+}
@@ -0,0 +1,407 @@
+package filehook
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The time layout of rotated segment names, ie `app-20170127T021045.473.log`.
+// Segments rotated within the same millisecond have a sequence suffix, ie
+// `app-20170127T021045.473-1.log`
+const rotateTimeLayout = "20060102T150405.000"
+
+// How long the hook waits before it retries a rotation which failed
+const rotateBackoff = time.Minute
+
+type FileHook struct {
+	conf  Config
+	debug bool
+
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	rotateAt time.Time
+	// Rotations are not attempted before this time after a failure
+	retryAt time.Time
+	closed  bool
+
+	// Sync stuff
+	mutex  sync.Mutex
+	wg     sync.WaitGroup
+	once   sync.Once
+	done   chan struct{}
+	mill   chan struct{}
+	signal chan os.Signal
+}
+
+type Config struct {
+	// The file records are written to, rotated segments are written next to it
+	Filename string
+	// Defaults to common.DefaultFormatter
+	Formatter logrus.Formatter
+	// File mode of new files, defaults to 0644
+	Mode os.FileMode
+
+	// Rotate the file when it grows beyond this many bytes, defaults to 100MB
+	MaxSize int64
+	// If provided, rotate the file at every multiple of this interval
+	RotateInterval time.Duration
+	// If true, rotated segments are compressed with gzip
+	Compress bool
+	// If provided, rotated segments older than this are removed
+	MaxAge time.Duration
+	// If provided, only this many of the most recent rotated segments are kept
+	MaxCount int
+
+	// Size of the write buffer, defaults to 64KB
+	BufferSize int
+	// Maximum time a record waits in the write buffer, defaults to 1 second
+	FlushInterval time.Duration
+}
+
+func New(conf Config) (*FileHook, error) {
+	if conf.Filename == "" {
+		return nil, errors.New("Filename is required")
+	}
+	setter.SetDefault(&conf.Formatter, common.DefaultFormatter)
+	setter.SetDefault(&conf.Mode, os.FileMode(0644))
+	setter.SetDefault(&conf.MaxSize, int64(100*1024*1024))
+	setter.SetDefault(&conf.BufferSize, 64*1024)
+	setter.SetDefault(&conf.FlushInterval, time.Second)
+
+	h := FileHook{
+		conf:   conf,
+		done:   make(chan struct{}),
+		mill:   make(chan struct{}, 1),
+		signal: make(chan os.Signal, 1),
+	}
+	if err := h.open(); err != nil {
+		return nil, err
+	}
+
+	// Reopen the file on SIGHUP after logrotate has moved it
+	signal.Notify(h.signal, syscall.SIGHUP)
+
+	h.wg.Add(2)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(conf.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := h.Flush(); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "[filehook] flush error: %s\n", err)
+				}
+			case <-h.signal:
+				if err := h.Reopen(); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "[filehook] reopen error: %s\n", err)
+				}
+			case <-h.done:
+				return
+			}
+		}
+	}()
+
+	// Compress and remove rotated segments in the background
+	go func() {
+		defer h.wg.Done()
+		for range h.mill {
+			if err := h.millSegments(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "[filehook] %s\n", err)
+			}
+		}
+	}()
+	h.startMill()
+	return &h, nil
+}
+
+func (h *FileHook) Fire(entry *logrus.Entry) error {
+	buf, err := h.conf.Formatter.Format(entry)
+	if err != nil {
+		return errors.Wrap(err, "while formatting entry")
+	}
+
+	if h.debug {
+		fmt.Printf("%s\n", string(buf))
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+
+	// A previous rotate or reopen failed to open the file
+	if h.file == nil {
+		if err := h.open(); err != nil {
+			return errors.Wrap(err, "FileHook.Fire()")
+		}
+	}
+
+	now := clock.Now()
+	if (h.size+int64(len(buf)) > h.conf.MaxSize && h.size != 0 ||
+		!h.rotateAt.IsZero() && !now.Before(h.rotateAt)) && !now.Before(h.retryAt) {
+		if err := h.rotate(); err != nil {
+			return errors.Wrap(err, "FileHook.Fire()")
+		}
+	}
+
+	n, err := h.writer.Write(buf)
+	h.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "FileHook.Fire()")
+	}
+	return nil
+}
+
+// Flush writes any buffered records to the file
+func (h *FileHook) Flush() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.writer == nil {
+		return nil
+	}
+	return h.writer.Flush()
+}
+
+// Reopen flushes and closes the file then opens the file by name, this is
+// done on SIGHUP so the file can be moved by logrotate. If the file can not
+// be opened it is opened again by the next Fire()
+func (h *FileHook) Reopen() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+	if h.file != nil {
+		if err := h.close(); err != nil {
+			return err
+		}
+	}
+	return h.open()
+}
+
+// Opens the file for appending, the caller must hold the mutex
+func (h *FileHook) open() error {
+	if err := os.MkdirAll(filepath.Dir(h.conf.Filename), 0755); err != nil {
+		return errors.Wrap(err, "while creating log directory")
+	}
+	file, err := os.OpenFile(h.conf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, h.conf.Mode)
+	if err != nil {
+		return errors.Wrapf(err, "while opening '%s'", h.conf.Filename)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "while opening '%s'", h.conf.Filename)
+	}
+
+	h.file = file
+	h.writer = bufio.NewWriterSize(file, h.conf.BufferSize)
+	h.size = info.Size()
+	if h.conf.RotateInterval > 0 {
+		h.rotateAt = clock.Now().Truncate(h.conf.RotateInterval).Add(h.conf.RotateInterval)
+	}
+	return nil
+}
+
+// Flushes and closes the file, the caller must hold the mutex
+func (h *FileHook) close() error {
+	err := h.writer.Flush()
+	if cerr := h.file.Close(); err == nil {
+		err = cerr
+	}
+	h.file, h.writer = nil, nil
+	return errors.Wrapf(err, "while closing '%s'", h.conf.Filename)
+}
+
+// Moves the file to a new segment and opens a new file, the caller must
+// hold the mutex. If the file can not be moved the hook keeps appending to
+// the file and retries the rotation after rotateBackoff.
+func (h *FileHook) rotate() error {
+	if err := h.close(); err != nil {
+		return err
+	}
+
+	rotated := true
+	if err := os.Rename(h.conf.Filename, h.segmentName(clock.Now())); err != nil {
+		rotated = false
+		h.retryAt = clock.Now().Add(rotateBackoff)
+		_, _ = fmt.Fprintf(os.Stderr, "[filehook] rotate error, retrying in %s: %s\n", rotateBackoff, err)
+	}
+
+	if err := h.open(); err != nil {
+		return err
+	}
+	if rotated {
+		h.startMill()
+	}
+	return nil
+}
+
+// Returns a name for a segment rotated at the time which is not used by
+// another segment, compressed or not
+func (h *FileHook) segmentName(t time.Time) string {
+	ext := filepath.Ext(h.conf.Filename)
+	prefix := strings.TrimSuffix(h.conf.Filename, ext) + "-" + t.Format(rotateTimeLayout)
+	name := prefix + ext
+	for seq := 1; exists(name) || exists(name+".gz"); seq++ {
+		name = fmt.Sprintf("%s-%d%s", prefix, seq, ext)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+func (h *FileHook) startMill() {
+	select {
+	case h.mill <- struct{}{}:
+	default:
+	}
+}
+
+type segment struct {
+	path string
+	time time.Time
+	seq  int
+}
+
+// Compresses the rotated segments and removes the segments which exceed the
+// retention
+func (h *FileHook) millSegments() error {
+	dir := filepath.Dir(h.conf.Filename)
+	ext := filepath.Ext(h.conf.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(h.conf.Filename), ext) + "-"
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "while listing segments")
+	}
+
+	var segments []segment
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		compressed := strings.HasSuffix(name, ext+".gz")
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name[len(prefix):], ".gz"), ext)
+		var seq int
+		if idx := strings.IndexByte(stamp, '-'); idx != -1 {
+			if seq, err = strconv.Atoi(stamp[idx+1:]); err != nil {
+				continue
+			}
+			stamp = stamp[:idx]
+		}
+		t, err := time.ParseInLocation(rotateTimeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if h.conf.Compress && !compressed {
+			if err := compressFile(path, h.conf.Mode); err != nil {
+				return err
+			}
+			path += ".gz"
+		}
+		segments = append(segments, segment{path: path, time: t, seq: seq})
+	}
+
+	// Newest segments first
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].time.Equal(segments[j].time) {
+			return segments[i].seq > segments[j].seq
+		}
+		return segments[i].time.After(segments[j].time)
+	})
+	for i, s := range segments {
+		if h.conf.MaxCount > 0 && i >= h.conf.MaxCount ||
+			h.conf.MaxAge > 0 && clock.Since(s.time) > h.conf.MaxAge {
+			if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "while removing segment")
+			}
+		}
+	}
+	return nil
+}
+
+// Compresses the file to `<path>.gz` and removes the file
+func compressFile(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "while compressing segment")
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return errors.Wrap(err, "while compressing segment")
+	}
+	w := gzip.NewWriter(dst)
+	_, err = io.Copy(w, src)
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return errors.Wrap(err, "while compressing segment")
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// Levels returns the available logging levels.
+func (h *FileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *FileHook) SetDebug(set bool) {
+	h.debug = set
+}
+
+// Close flushes any buffered records and closes the file
+func (h *FileHook) Close() error {
+	var err error
+	h.once.Do(func() {
+		signal.Stop(h.signal)
+		close(h.done)
+
+		h.mutex.Lock()
+		h.closed = true
+		if h.file != nil {
+			err = h.close()
+		}
+		close(h.mill)
+		h.mutex.Unlock()
+
+		h.wg.Wait()
+	})
+	return err
+}
@@ -0,0 +1,280 @@
+package filehook_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/logrus-hooks/filehook"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestFileHook(t *testing.T) { TestingT(t) }
+
+type FileHookTests struct {
+	dir      string
+	filename string
+	log      *logrus.Logger
+}
+
+var _ = Suite(&FileHookTests{})
+
+func (s *FileHookTests) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.filename = filepath.Join(s.dir, "app.log")
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+}
+
+func (s *FileHookTests) newHook(c *C, conf filehook.Config) *filehook.FileHook {
+	conf.Filename = s.filename
+	hook, err := filehook.New(conf)
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+	return hook
+}
+
+// Returns the messages of the records in the file
+func readMessages(c *C, path string) []string {
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		c.Assert(err, IsNil)
+		r = gz
+	}
+
+	var result []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		c.Assert(json.Unmarshal(scanner.Bytes(), &rec), IsNil)
+		result = append(result, rec["message"].(string))
+	}
+	return result
+}
+
+// Returns the rotated segments in the directory sorted by name
+func (s *FileHookTests) segments(c *C) []string {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "app-*"))
+	c.Assert(err, IsNil)
+	sort.Strings(matches)
+	return matches
+}
+
+func (s *FileHookTests) TestCloseFlushes(c *C) {
+	hook := s.newHook(c, filehook.Config{FlushInterval: time.Hour})
+
+	s.log.Info("one")
+	s.log.WithFields(logrus.Fields{"domain": "example.com"}).Info("two")
+	c.Assert(readMessages(c, s.filename), HasLen, 0)
+
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"one", "two"})
+	c.Assert(hook.Fire(logrus.NewEntry(s.log)), ErrorMatches, "hook is closed")
+}
+
+func (s *FileHookTests) TestFlushInterval(c *C) {
+	hook := s.newHook(c, filehook.Config{FlushInterval: 10 * time.Millisecond})
+	defer hook.Close()
+
+	s.log.Info("one")
+	for i := 0; i < 100 && len(readMessages(c, s.filename)) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"one"})
+}
+
+func (s *FileHookTests) TestAppends(c *C) {
+	hook := s.newHook(c, filehook.Config{})
+	s.log.Info("one")
+	c.Assert(hook.Close(), IsNil)
+
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+	hook = s.newHook(c, filehook.Config{})
+	s.log.Info("two")
+	c.Assert(hook.Close(), IsNil)
+
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"one", "two"})
+}
+
+func (s *FileHookTests) TestRotateBySize(c *C) {
+	hook := s.newHook(c, filehook.Config{MaxSize: 10})
+
+	s.log.Info("one")
+	time.Sleep(2 * time.Millisecond)
+	s.log.Info("two")
+	time.Sleep(2 * time.Millisecond)
+	s.log.Info("three")
+	c.Assert(hook.Close(), IsNil)
+
+	segments := s.segments(c)
+	c.Assert(segments, HasLen, 2)
+	c.Assert(readMessages(c, segments[0]), DeepEquals, []string{"one"})
+	c.Assert(readMessages(c, segments[1]), DeepEquals, []string{"two"})
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"three"})
+}
+
+func (s *FileHookTests) TestRotateSameTime(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+	hook := s.newHook(c, filehook.Config{MaxSize: 10, MaxCount: 2})
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		s.log.Info(msg)
+	}
+	c.Assert(hook.Close(), IsNil)
+
+	// Segments rotated in the same millisecond do not overwrite each other,
+	// and the oldest is removed first
+	segments := s.segments(c)
+	c.Assert(segments, HasLen, 2)
+	c.Assert(strings.HasSuffix(segments[0], "-1.log"), Equals, true, Commentf(segments[0]))
+	c.Assert(readMessages(c, segments[0]), DeepEquals, []string{"two"})
+	c.Assert(strings.HasSuffix(segments[1], "-2.log"), Equals, true, Commentf(segments[1]))
+	c.Assert(readMessages(c, segments[1]), DeepEquals, []string{"three"})
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"four"})
+}
+
+func (s *FileHookTests) TestRotateError(c *C) {
+	hook := s.newHook(c, filehook.Config{MaxSize: 10})
+
+	s.log.Info("one")
+	c.Assert(hook.Flush(), IsNil)
+
+	// The file can not be moved, the hook keeps writing to a new file and
+	// does not retry the rotation on every record
+	c.Assert(os.Remove(s.filename), IsNil)
+	s.log.Info("two")
+	s.log.Info("three")
+	c.Assert(hook.Close(), IsNil)
+
+	c.Assert(s.segments(c), HasLen, 0)
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"two", "three"})
+}
+
+func (s *FileHookTests) TestOpenRetried(c *C) {
+	hook := s.newHook(c, filehook.Config{})
+	defer hook.Close()
+
+	// The file can not be opened
+	c.Assert(os.Remove(s.filename), IsNil)
+	c.Assert(os.Mkdir(s.filename, 0755), IsNil)
+	c.Assert(hook.Reopen(), NotNil)
+	c.Assert(hook.Fire(logrus.NewEntry(s.log)), ErrorMatches, "FileHook.Fire.*while opening.*")
+
+	// The next record opens the file
+	c.Assert(os.Remove(s.filename), IsNil)
+	s.log.Info("one")
+	c.Assert(hook.Flush(), IsNil)
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"one"})
+}
+
+func (s *FileHookTests) TestFireAfterClose(c *C) {
+	hook := s.newHook(c, filehook.Config{})
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(hook.Fire(logrus.NewEntry(s.log)), ErrorMatches, "hook is closed")
+}
+
+func (s *FileHookTests) TestRotateByTime(c *C) {
+	hook := s.newHook(c, filehook.Config{RotateInterval: 50 * time.Millisecond})
+
+	s.log.Info("one")
+	time.Sleep(60 * time.Millisecond)
+	s.log.Info("two")
+	c.Assert(hook.Close(), IsNil)
+
+	segments := s.segments(c)
+	c.Assert(segments, HasLen, 1)
+	c.Assert(readMessages(c, segments[0]), DeepEquals, []string{"one"})
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"two"})
+}
+
+func (s *FileHookTests) TestCompress(c *C) {
+	hook := s.newHook(c, filehook.Config{MaxSize: 10, Compress: true})
+
+	s.log.Info("one")
+	s.log.Info("two")
+	c.Assert(hook.Close(), IsNil)
+
+	segments := s.segments(c)
+	c.Assert(segments, HasLen, 1)
+	c.Assert(strings.HasSuffix(segments[0], ".log.gz"), Equals, true, Commentf(segments[0]))
+	c.Assert(readMessages(c, segments[0]), DeepEquals, []string{"one"})
+}
+
+func (s *FileHookTests) TestMaxCount(c *C) {
+	hook := s.newHook(c, filehook.Config{MaxSize: 10, MaxCount: 2})
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		s.log.Info(msg)
+		time.Sleep(2 * time.Millisecond)
+	}
+	c.Assert(hook.Close(), IsNil)
+
+	segments := s.segments(c)
+	c.Assert(segments, HasLen, 2)
+	c.Assert(readMessages(c, segments[0]), DeepEquals, []string{"two"})
+	c.Assert(readMessages(c, segments[1]), DeepEquals, []string{"three"})
+}
+
+func (s *FileHookTests) TestMaxAge(c *C) {
+	old := filepath.Join(s.dir, "app-"+time.Now().Add(-48*time.Hour).Format("20060102T150405.000")+".log")
+	c.Assert(ioutil.WriteFile(old, []byte("{}\n"), 0644), IsNil)
+	unrelated := filepath.Join(s.dir, "app-other.log")
+	c.Assert(ioutil.WriteFile(unrelated, []byte("{}\n"), 0644), IsNil)
+
+	hook := s.newHook(c, filehook.Config{MaxAge: 24 * time.Hour})
+	c.Assert(hook.Close(), IsNil)
+
+	_, err := os.Stat(old)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(unrelated)
+	c.Assert(err, IsNil)
+}
+
+func (s *FileHookTests) TestReopenOnSIGHUP(c *C) {
+	hook := s.newHook(c, filehook.Config{})
+	defer hook.Close()
+
+	s.log.Info("one")
+	c.Assert(hook.Flush(), IsNil)
+
+	// Move the file like logrotate
+	moved := filepath.Join(s.dir, "app.log.1")
+	c.Assert(os.Rename(s.filename, moved), IsNil)
+
+	p, err := os.FindProcess(os.Getpid())
+	c.Assert(err, IsNil)
+	c.Assert(p.Signal(syscall.SIGHUP), IsNil)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(s.filename); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.log.Info("two")
+	c.Assert(hook.Flush(), IsNil)
+	c.Assert(readMessages(c, moved), DeepEquals, []string{"one"})
+	c.Assert(readMessages(c, s.filename), DeepEquals, []string{"two"})
+}
+
+func (s *FileHookTests) TestFilenameRequired(c *C) {
+	_, err := filehook.New(filehook.Config{})
+	c.Assert(err, ErrorMatches, "Filename is required")
+}
@@ -0,0 +1,128 @@
+package filterhook
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Predicate decides if an entry is kept
+type Predicate func(entry *logrus.Entry) bool
+
+// FilterHook forwards the entries which match the predicate to the wrapped hook
+type FilterHook struct {
+	hook logrus.Hook
+	keep Predicate
+}
+
+// New returns a hook which forwards the entries which match keep to the hook,
+// use Not() to drop the entries which match a predicate instead
+func New(hook logrus.Hook, keep Predicate) *FilterHook {
+	return &FilterHook{hook: hook, keep: keep}
+}
+
+// NewFromConfig returns a hook which forwards the entries which match the
+// expression to the hook. See Parse() for the syntax of the expression.
+func NewFromConfig(hook logrus.Hook, expr string) (*FilterHook, error) {
+	keep, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return New(hook, keep), nil
+}
+
+// Levels returns the levels of the wrapped hook
+func (h *FilterHook) Levels() []logrus.Level {
+	return h.hook.Levels()
+}
+
+func (h *FilterHook) Fire(entry *logrus.Entry) error {
+	if !h.keep(entry) {
+		return nil
+	}
+	return h.hook.Fire(entry)
+}
+
+// FieldEquals matches entries with the field formatted by fmt.Sprint() equal to the value
+func FieldEquals(key, value string) Predicate {
+	return FieldIn(key, value)
+}
+
+// FieldIn matches entries with the field formatted by fmt.Sprint() equal to one of the values
+func FieldIn(key string, values ...string) Predicate {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return func(entry *logrus.Entry) bool {
+		v, ok := entry.Data[key]
+		return ok && set[fmt.Sprint(v)]
+	}
+}
+
+// FieldExists matches entries which have the field
+func FieldExists(key string) Predicate {
+	return func(entry *logrus.Entry) bool {
+		_, ok := entry.Data[key]
+		return ok
+	}
+}
+
+// FieldMatches matches entries with the field formatted by fmt.Sprint() matching the regex
+func FieldMatches(key string, re *regexp.Regexp) Predicate {
+	return func(entry *logrus.Entry) bool {
+		v, ok := entry.Data[key]
+		return ok && re.MatchString(fmt.Sprint(v))
+	}
+}
+
+// MessageMatches matches entries with a message matching the regex
+func MessageMatches(re *regexp.Regexp) Predicate {
+	return func(entry *logrus.Entry) bool {
+		return re.MatchString(entry.Message)
+	}
+}
+
+// LevelRange matches entries with a level between the levels, inclusive. The
+// levels may be given in any order, ie LevelRange(logrus.ErrorLevel, logrus.InfoLevel)
+// matches error, warning and info entries.
+func LevelRange(from, to logrus.Level) Predicate {
+	if from > to {
+		from, to = to, from
+	}
+	return func(entry *logrus.Entry) bool {
+		return entry.Level >= from && entry.Level <= to
+	}
+}
+
+// And matches entries which match every predicate
+func And(preds ...Predicate) Predicate {
+	return func(entry *logrus.Entry) bool {
+		for _, p := range preds {
+			if !p(entry) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches entries which match at least one predicate
+func Or(preds ...Predicate) Predicate {
+	return func(entry *logrus.Entry) bool {
+		for _, p := range preds {
+			if p(entry) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches entries which do not match the predicate
+func Not(pred Predicate) Predicate {
+	return func(entry *logrus.Entry) bool {
+		return !pred(entry)
+	}
+}
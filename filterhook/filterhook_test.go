@@ -0,0 +1,187 @@
+package filterhook_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/mailgun/logrus-hooks/filterhook"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterHookSuite struct{}
+
+var _ = Suite(&FilterHookSuite{})
+
+type fakeHook struct {
+	fired []string
+	err   error
+}
+
+func (h *fakeHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fakeHook) Fire(entry *logrus.Entry) error {
+	h.fired = append(h.fired, entry.Message)
+	return h.err
+}
+
+func newEntry(level logrus.Level, msg string, fields logrus.Fields) *logrus.Entry {
+	return &logrus.Entry{Level: level, Message: msg, Data: fields}
+}
+
+func (s *FilterHookSuite) TestPredicates(c *C) {
+	entry := newEntry(logrus.WarnLevel, "connection reset by peer", logrus.Fields{
+		"category":   "healthcheck",
+		"account_id": "acme",
+		"status":     503,
+	})
+
+	for i, tc := range []struct {
+		pred     filterhook.Predicate
+		expected bool
+	}{
+		0:  {filterhook.FieldEquals("category", "healthcheck"), true},
+		1:  {filterhook.FieldEquals("category", "http"), false},
+		2:  {filterhook.FieldEquals("status", "503"), true},
+		3:  {filterhook.FieldEquals("missing", ""), false},
+		4:  {filterhook.FieldIn("account_id", "initech", "acme"), true},
+		5:  {filterhook.FieldIn("account_id", "initech"), false},
+		6:  {filterhook.FieldExists("status"), true},
+		7:  {filterhook.FieldExists("missing"), false},
+		8:  {filterhook.FieldMatches("status", regexp.MustCompile(`^5\d\d$`)), true},
+		9:  {filterhook.FieldMatches("missing", regexp.MustCompile(`.*`)), false},
+		10: {filterhook.MessageMatches(regexp.MustCompile(`reset`)), true},
+		11: {filterhook.LevelRange(logrus.ErrorLevel, logrus.InfoLevel), true},
+		12: {filterhook.LevelRange(logrus.InfoLevel, logrus.ErrorLevel), true},
+		13: {filterhook.LevelRange(logrus.PanicLevel, logrus.ErrorLevel), false},
+		14: {filterhook.And(filterhook.FieldExists("status"), filterhook.FieldExists("category")), true},
+		15: {filterhook.And(filterhook.FieldExists("status"), filterhook.FieldExists("missing")), false},
+		16: {filterhook.And(), true},
+		17: {filterhook.Or(filterhook.FieldExists("missing"), filterhook.FieldExists("category")), true},
+		18: {filterhook.Or(), false},
+		19: {filterhook.Not(filterhook.FieldExists("missing")), true},
+	} {
+		c.Logf("Test case #%d", i)
+		c.Assert(tc.pred(entry), Equals, tc.expected)
+	}
+}
+
+func (s *FilterHookSuite) TestFire(c *C) {
+	hook := &fakeHook{}
+	filter := filterhook.New(hook, filterhook.Not(filterhook.FieldEquals("category", "healthcheck")))
+	c.Assert(filter.Levels(), DeepEquals, logrus.AllLevels)
+
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "dropped", logrus.Fields{"category": "healthcheck"})), IsNil)
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "kept", logrus.Fields{"category": "http"})), IsNil)
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "no category", logrus.Fields{})), IsNil)
+	c.Assert(hook.fired, DeepEquals, []string{"kept", "no category"})
+
+	// Errors of the wrapped hook are returned
+	hook.err = errors.New("kaboom")
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "kept", logrus.Fields{})), ErrorMatches, "kaboom")
+}
+
+func (s *FilterHookSuite) TestParse(c *C) {
+	entries := []*logrus.Entry{
+		0: newEntry(logrus.InfoLevel, "GET /health", logrus.Fields{"category": "healthcheck"}),
+		1: newEntry(logrus.ErrorLevel, "connection reset by peer", logrus.Fields{"account_id": "acme", "path": "/api/v1"}),
+		2: newEntry(logrus.DebugLevel, "cache miss", logrus.Fields{"account_id": "initech", "request_id": 42}),
+		3: newEntry(logrus.WarnLevel, "slow query", logrus.Fields{"account_id": "hooli", "path": "/static/app.js"}),
+		// Forwarded from another logger with its own level and msg fields
+		4: newEntry(logrus.InfoLevel, "forwarded", logrus.Fields{"level": "debug", "msg": "upstream said hi", "exists": "yes"}),
+	}
+
+	for i, tc := range []struct {
+		expr string
+		// Indexes of the entries the expression matches
+		expected []int
+	}{
+		0:  {`category == "healthcheck"`, []int{0}},
+		1:  {`category != healthcheck`, []int{1, 2, 3, 4}},
+		2:  {`account_id in ("acme", initech)`, []int{1, 2}},
+		3:  {`exists(request_id)`, []int{2}},
+		4:  {`request_id == 42`, []int{2}},
+		5:  {`path =~ "^/api/"`, []int{1}},
+		6:  {`path !~ "^/api/"`, []int{0, 2, 3, 4}},
+		7:  {`msg =~ "(reset|slow)"`, []int{1, 3}},
+		8:  {`msg !~ "(reset|slow)"`, []int{0, 2, 4}},
+		9:  {`msg == "cache miss"`, []int{2}},
+		10: {`msg in ("cache miss", "slow query")`, []int{2, 3}},
+		11: {`level <= warn`, []int{1, 3}},
+		12: {`level < warn`, []int{1}},
+		13: {`level >= info`, []int{0, 2, 4}},
+		14: {`level > info`, []int{2}},
+		15: {`level == error`, []int{1}},
+		16: {`level != error`, []int{0, 2, 3, 4}},
+		17: {`level in (debug, warning)`, []int{2, 3}},
+		18: {`level < panic`, nil},
+		19: {`not category == healthcheck and account_id in (acme, hooli)`, []int{1, 3}},
+		20: {`account_id == acme or account_id == hooli and level == debug`, []int{1}},
+		21: {`(account_id == acme or account_id == hooli) and level == warn`, []int{3}},
+		22: {`not (exists(account_id) or exists(category))`, []int{4}},
+		23: {"# Drop health checks\nnot category == healthcheck # from the load balancer\nAND level <= info", []int{1, 3, 4}},
+		// Quoted names are fields even if they are the names of keywords
+		24: {`"level" == debug`, []int{4}},
+		25: {`"level" in (debug, trace)`, []int{4}},
+		26: {`"msg" =~ "^upstream"`, []int{4}},
+		27: {`exists("level")`, []int{4}},
+		28: {`"exists" == yes`, []int{4}},
+		29: {`"category" == healthcheck`, []int{0}},
+	} {
+		c.Logf("Test case #%d", i)
+		pred, err := filterhook.Parse(tc.expr)
+		c.Assert(err, IsNil)
+
+		var matched []int
+		for j, entry := range entries {
+			if pred(entry) {
+				matched = append(matched, j)
+			}
+		}
+		c.Assert(matched, DeepEquals, tc.expected)
+	}
+}
+
+func (s *FilterHookSuite) TestParseErrors(c *C) {
+	for i, tc := range []struct {
+		expr string
+		err  string
+	}{
+		0:  {``, `while parsing filter: expected a field name at offset 0, got end of filter`},
+		1:  {`category`, `while parsing filter: expected an operator at offset 8, got end of filter`},
+		2:  {`category ==`, `while parsing filter: expected a value at offset 11, got end of filter`},
+		3:  {`category == "healthcheck`, `while parsing filter: unterminated string at offset 12`},
+		4:  {`category == a b`, `while parsing filter: unexpected 'b' at offset 14`},
+		5:  {`category < a`, `while parsing filter: operator '<' at offset 9 is only supported for level`},
+		6:  {`msg < a`, `while parsing filter: operator '<' at offset 4 is not supported for msg`},
+		7:  {`level <= loud`, `while parsing filter: invalid level at offset 9: not a valid logrus Level: "loud"`},
+		8:  {`path =~ "("`, `while parsing filter: invalid regex at offset 5: .*`},
+		9:  {`(category == a`, `while parsing filter: expected '\)' at offset 14, got end of filter`},
+		10: {`account_id in (a b)`, `while parsing filter: expected ',' or '\)' at offset 17, got 'b'`},
+		11: {`category == a & b`, `while parsing filter: unexpected '&' at offset 14`},
+		12: {`exists()`, `while parsing filter: expected a field name at offset 7, got '\)'`},
+		13: {`level in (debug, loud)`, `while parsing filter: invalid level at offset 17: not a valid logrus Level: "loud"`},
+		14: {`"level" < a`, `while parsing filter: operator '<' at offset 8 is only supported for level`},
+	} {
+		c.Logf("Test case #%d", i)
+		_, err := filterhook.Parse(tc.expr)
+		c.Assert(err, ErrorMatches, tc.err)
+	}
+}
+
+func (s *FilterHookSuite) TestNewFromConfig(c *C) {
+	hook := &fakeHook{}
+	filter, err := filterhook.NewFromConfig(hook, `account_id in (acme)`)
+	c.Assert(err, IsNil)
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "kept", logrus.Fields{"account_id": "acme"})), IsNil)
+	c.Assert(filter.Fire(newEntry(logrus.InfoLevel, "dropped", logrus.Fields{"account_id": "hooli"})), IsNil)
+	c.Assert(hook.fired, DeepEquals, []string{"kept"})
+
+	_, err = filterhook.NewFromConfig(hook, `account_id in`)
+	c.Assert(err, NotNil)
+}
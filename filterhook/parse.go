@@ -0,0 +1,424 @@
+package filterhook
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Parse returns the predicate described by the expression. The expression
+// combines conditions with `and`, `or`, `not` and parentheses. The
+// conditions are
+//
+//	category == "healthcheck"      field formatted by fmt.Sprint() equals the value
+//	category != "healthcheck"      field is missing or not equal to the value
+//	account_id in (acme, initech)  field equals one of the values
+//	exists(request_id)             field is present
+//	path =~ "^/api/"               field matches the regex
+//	path !~ "^/api/"               field is missing or does not match the regex
+//	msg =~ "reset|refused"         message matches the regex
+//	level <= info                  level is info or more severe
+//	level in (warn, error)         level is one of the levels
+//	"level" == debug               field named level equals the value
+//
+// Levels compare by verbosity so `level <= warn` matches panic, fatal, error
+// and warning entries. A double quoted field name always names a field, so
+// the fields named `level`, `msg` or `exists` can be filtered on. Values are
+// double quoted strings or bare words. `and`
+// binds tighter than `or`. Newlines are whitespace and `#` starts a comment
+// which runs to the end of the line, so expressions can be read from a file.
+func Parse(expr string) (Predicate, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, errors.Wrap(err, "while parsing filter")
+	}
+	p := parser{tokens: tokens}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, errors.Wrap(err, "while parsing filter")
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errors.Errorf("while parsing filter: unexpected %s at offset %d", t, t.pos)
+	}
+	return pred, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.value)
+	}
+	return fmt.Sprintf("'%s'", t.value)
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "<=", ">=", "<", ">"}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == '#':
+			for i < len(expr) && expr[i] != '\n' {
+				i++
+			}
+			continue
+		case unicode.IsSpace(rune(c)):
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+			continue
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+			continue
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			value, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d", i)
+			}
+			tokens = append(tokens, token{tokString, value, i})
+			i = end + 1
+			continue
+		}
+
+		if op := matchOperator(expr[i:]); op != "" {
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+			continue
+		}
+		if !isWordChar(c) {
+			return nil, fmt.Errorf("unexpected '%c' at offset %d", c, i)
+		}
+		end := i
+		for end < len(expr) && isWordChar(expr[end]) {
+			end++
+		}
+		tokens = append(tokens, token{tokWord, expr[i:end], i})
+		i = end
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+func matchOperator(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '/' || c == ':' || c == '@' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// Returns true and consumes the token if it is the keyword
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.value, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, what string) error {
+	if t := p.take(); t.kind != kind {
+		return fmt.Errorf("expected %s at offset %d, got %s", what, t.pos, t)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Predicate, error) {
+	pred, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{pred}
+	for p.keyword("or") {
+		if pred, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return Or(preds...), nil
+}
+
+func (p *parser) parseAnd() (Predicate, error) {
+	pred, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{pred}
+	for p.keyword("and") {
+		if pred, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return And(preds...), nil
+}
+
+func (p *parser) parseUnary() (Predicate, error) {
+	if p.keyword("not") {
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+	}
+	if p.peek().kind == tokLParen {
+		p.take()
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return pred, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (Predicate, error) {
+	t := p.take()
+	if t.kind != tokWord && t.kind != tokString {
+		return nil, fmt.Errorf("expected a field name at offset %d, got %s", t.pos, t)
+	}
+
+	// A quoted name is a field even if it is the name of a keyword
+	if t.kind == tokWord && strings.EqualFold(t.value, "exists") && p.peek().kind == tokLParen {
+		p.take()
+		name := p.take()
+		if name.kind != tokWord && name.kind != tokString {
+			return nil, fmt.Errorf("expected a field name at offset %d, got %s", name.pos, name)
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return FieldExists(name.value), nil
+	}
+
+	field := t.value
+	op := p.take()
+	switch {
+	case op.kind == tokWord && strings.EqualFold(op.value, "in"):
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokString {
+			return FieldIn(field, tokenValues(values)...), nil
+		}
+		return p.fieldIn(field, values)
+	case op.kind != tokOp:
+		return nil, fmt.Errorf("expected an operator at offset %d, got %s", op.pos, op)
+	}
+
+	valueToken := p.peek()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.kind == tokString:
+	case field == "level":
+		return levelCondition(op, valueToken)
+	case field == "msg":
+		switch op.value {
+		case "=~", "!~":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex at offset %d: %s", op.pos, err)
+			}
+			if op.value == "!~" {
+				return Not(MessageMatches(re)), nil
+			}
+			return MessageMatches(re), nil
+		case "==":
+			return func(entry *logrus.Entry) bool { return entry.Message == value }, nil
+		case "!=":
+			return func(entry *logrus.Entry) bool { return entry.Message != value }, nil
+		}
+		return nil, fmt.Errorf("operator '%s' at offset %d is not supported for msg", op.value, op.pos)
+	}
+
+	switch op.value {
+	case "==":
+		return FieldEquals(field, value), nil
+	case "!=":
+		return Not(FieldEquals(field, value)), nil
+	case "=~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at offset %d: %s", op.pos, err)
+		}
+		if op.value == "!~" {
+			return Not(FieldMatches(field, re)), nil
+		}
+		return FieldMatches(field, re), nil
+	}
+	return nil, fmt.Errorf("operator '%s' at offset %d is only supported for level", op.value, op.pos)
+}
+
+func (p *parser) fieldIn(field string, values []token) (Predicate, error) {
+	switch field {
+	case "level":
+		var preds []Predicate
+		for _, v := range values {
+			level, err := parseLevel(v)
+			if err != nil {
+				return nil, err
+			}
+			preds = append(preds, LevelRange(level, level))
+		}
+		return Or(preds...), nil
+	case "msg":
+		set := make(map[string]bool, len(values))
+		for _, v := range values {
+			set[v.value] = true
+		}
+		return func(entry *logrus.Entry) bool { return set[entry.Message] }, nil
+	}
+	return FieldIn(field, tokenValues(values)...), nil
+}
+
+func tokenValues(tokens []token) []string {
+	values := make([]string, len(tokens))
+	for i, t := range tokens {
+		values[i] = t.value
+	}
+	return values
+}
+
+// Returns the tokens of the values in the list
+func (p *parser) parseList() ([]token, error) {
+	if err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+	var values []token
+	for {
+		v := p.peek()
+		if _, err := p.parseValue(); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		t := p.take()
+		if t.kind == tokRParen {
+			return values, nil
+		}
+		if t.kind != tokComma {
+			return nil, fmt.Errorf("expected ',' or ')' at offset %d, got %s", t.pos, t)
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.take()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", fmt.Errorf("expected a value at offset %d, got %s", t.pos, t)
+	}
+	return t.value, nil
+}
+
+func parseLevel(value token) (logrus.Level, error) {
+	level, err := logrus.ParseLevel(value.value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid level at offset %d: %s", value.pos, err)
+	}
+	return level, nil
+}
+
+func levelCondition(op, value token) (Predicate, error) {
+	level, err := parseLevel(value)
+	if err != nil {
+		return nil, err
+	}
+	switch op.value {
+	case "==":
+		return LevelRange(level, level), nil
+	case "!=":
+		return Not(LevelRange(level, level)), nil
+	case "<=":
+		return LevelRange(logrus.PanicLevel, level), nil
+	case "<":
+		if level == logrus.PanicLevel {
+			return Not(LevelRange(logrus.PanicLevel, logrus.TraceLevel)), nil
+		}
+		return LevelRange(logrus.PanicLevel, level-1), nil
+	case ">=":
+		return LevelRange(level, logrus.TraceLevel), nil
+	case ">":
+		if level == logrus.TraceLevel {
+			return Not(LevelRange(logrus.PanicLevel, logrus.TraceLevel)), nil
+		}
+		return LevelRange(level+1, logrus.TraceLevel), nil
+	}
+	return nil, fmt.Errorf("operator '%s' at offset %d is not supported for level", op.value, op.pos)
+}
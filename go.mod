@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/Shopify/sarama v1.23.1
 	github.com/fatih/structs v1.1.0 // indirect
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-ini/ini v1.46.0 // indirect
 	github.com/mailgun/holster/v3 v3.3.2
 	github.com/mailru/easyjson v0.0.0-20190626092158-b2ccc519800e
@@ -16,6 +17,8 @@ require (
 	github.com/spf13/cast v1.3.0 // indirect
 	github.com/stretchr/testify v1.4.0
 	github.com/thrawn01/args v0.3.0
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127
 	gopkg.in/ini.v1 v1.46.0 // indirect
 	gopkg.in/jcmturner/goidentity.v3 v3.0.0 // indirect
@@ -0,0 +1,147 @@
+package httphook
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/mailru/easyjson/jwriter"
+)
+
+// Encoder builds the request body for a batch of formatted records
+type Encoder interface {
+	// Returns the body and the content type of the request
+	Encode(batch []Item) ([]byte, string, error)
+}
+
+// NDJSONEncoder sends one record per line, suitable for generic webhooks
+type NDJSONEncoder struct{}
+
+func (NDJSONEncoder) Encode(batch []Item) ([]byte, string, error) {
+	var buf bytes.Buffer
+	for _, item := range batch {
+		writeLine(&buf, item.Data)
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// JSONArrayEncoder sends the records as a JSON array
+type JSONArrayEncoder struct{}
+
+func (JSONArrayEncoder) Encode(batch []Item) ([]byte, string, error) {
+	var w jwriter.Writer
+	w.RawByte('[')
+	for i, item := range batch {
+		if i != 0 {
+			w.RawByte(',')
+		}
+		w.Raw(bytes.TrimSpace(item.Data), nil)
+	}
+	w.RawByte(']')
+	buf, err := w.BuildBytes()
+	return buf, "application/json", err
+}
+
+// ElasticsearchEncoder sends the records to the Elasticsearch `_bulk` API
+type ElasticsearchEncoder struct {
+	// The index records are added to, may be empty if the URL includes the index
+	Index string
+}
+
+func (e ElasticsearchEncoder) Encode(batch []Item) ([]byte, string, error) {
+	action := []byte(`{"index":{}}`)
+	if e.Index != "" {
+		var w jwriter.Writer
+		w.RawString(`{"index":{"_index":`)
+		w.String(e.Index)
+		w.RawString(`}}`)
+		action = w.Buffer.BuildBytes()
+	}
+
+	var buf bytes.Buffer
+	for _, item := range batch {
+		writeLine(&buf, action)
+		writeLine(&buf, item.Data)
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// SplunkEncoder sends the records to the Splunk HTTP Event Collector. The
+// token must be provided in the `Authorization: Splunk <token>` header.
+type SplunkEncoder struct {
+	Index      string
+	Source     string
+	SourceType string
+}
+
+func (e SplunkEncoder) Encode(batch []Item) ([]byte, string, error) {
+	var w jwriter.Writer
+	for _, item := range batch {
+		w.RawString(`{"time":`)
+		w.RawString(strconv.FormatFloat(float64(item.Time.UnixNano())/1000000000, 'f', 3, 64))
+		if e.Index != "" {
+			w.RawString(`,"index":`)
+			w.String(e.Index)
+		}
+		if e.Source != "" {
+			w.RawString(`,"source":`)
+			w.String(e.Source)
+		}
+		if e.SourceType != "" {
+			w.RawString(`,"sourcetype":`)
+			w.String(e.SourceType)
+		}
+		w.RawString(`,"event":`)
+		w.Raw(eventValue(item.Data), nil)
+		w.RawByte('}')
+	}
+	buf, err := w.BuildBytes()
+	return buf, "application/json", err
+}
+
+// LokiEncoder sends the records to the Loki push API as a single stream
+type LokiEncoder struct {
+	// Labels of the stream, defaults to `{"job": "logrus"}`
+	Labels map[string]string
+}
+
+func (e LokiEncoder) Encode(batch []Item) ([]byte, string, error) {
+	labels := e.Labels
+	if len(labels) == 0 {
+		labels = map[string]string{"job": "logrus"}
+	}
+
+	values := make([][2]string, len(batch))
+	for i, item := range batch {
+		values[i] = [2]string{
+			strconv.FormatInt(item.Time.UnixNano(), 10),
+			string(bytes.TrimSpace(item.Data)),
+		}
+	}
+
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	buf, err := json.Marshal(map[string][]stream{
+		"streams": {{Stream: labels, Values: values}},
+	})
+	return buf, "application/json", err
+}
+
+func writeLine(buf *bytes.Buffer, data []byte) {
+	buf.Write(bytes.TrimRight(data, "\n"))
+	buf.WriteByte('\n')
+}
+
+// Returns the record as a JSON value, records which are not JSON are sent
+// as a string
+func eventValue(data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if json.Valid(data) {
+		return data
+	}
+	var w jwriter.Writer
+	w.String(string(data))
+	return w.Buffer.BuildBytes()
+}
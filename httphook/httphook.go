@@ -0,0 +1,321 @@
+package httphook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailgun/holster/v3/errors"
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+)
+
+type HTTPHook struct {
+	// Accessed atomically, first for 64 bit alignment on 32 bit platforms
+	overflows int64
+
+	queue chan Item
+	conf  Config
+	debug bool
+
+	// Canceled to abort the posts and retries of a closing hook
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Sync stuff
+	wg         sync.WaitGroup
+	once       sync.Once
+	mutex      sync.Mutex
+	lastErr    error
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+type Config struct {
+	// The URL batches of records are posted to
+	URL string
+	// Builds the request body for a batch, defaults to NDJSONEncoder
+	Encoder Encoder
+	// Formats each record, defaults to common.DefaultFormatter
+	Formatter logrus.Formatter
+	// Client used to post the batches, defaults to a client with a 30 second timeout
+	Client *http.Client
+	// Headers added to every request
+	Headers http.Header
+	// If provided, requests are sent with basic auth
+	Username string
+	Password string
+	// If provided, requests are sent with an `Authorization: Bearer` header
+	BearerToken string
+	// If true, request bodies are compressed with gzip
+	Gzip bool
+
+	// Maximum number of records in a batch, defaults to 100
+	BatchSize int
+	// Maximum size of the records in a batch, defaults to 1MB
+	BatchBytes int
+	// Maximum time a record waits before its batch is sent, defaults to 1 second
+	FlushInterval time.Duration
+	// Number of records buffered before new records are dropped, defaults to 1000
+	BufferSize int
+
+	// Number of times a batch is retried after a 429, 5xx or network error, defaults to 5
+	MaxRetries int
+	// Wait before the first retry, doubled on each retry, defaults to 500ms
+	RetryBackoff time.Duration
+	// Maximum wait between retries, defaults to 30 seconds
+	MaxRetryBackoff time.Duration
+	// Maximum time Close waits for the remaining records to be posted, after
+	// which pending posts and retries are aborted. Defaults to 10 seconds
+	CloseTimeout time.Duration
+}
+
+// Item is a formatted record waiting in a batch
+type Item struct {
+	Time  time.Time
+	Level logrus.Level
+	Data  []byte
+}
+
+func New(conf Config) (*HTTPHook, error) {
+	if conf.URL == "" {
+		return nil, errors.New("URL is required")
+	}
+
+	setter.SetDefault(&conf.Encoder, NDJSONEncoder{})
+	setter.SetDefault(&conf.Formatter, common.DefaultFormatter)
+	setter.SetDefault(&conf.Client, &http.Client{Timeout: 30 * time.Second})
+	setter.SetDefault(&conf.BatchSize, 100)
+	setter.SetDefault(&conf.BatchBytes, 1024*1024)
+	setter.SetDefault(&conf.FlushInterval, time.Second)
+	setter.SetDefault(&conf.BufferSize, 1000)
+	setter.SetDefault(&conf.MaxRetries, 5)
+	setter.SetDefault(&conf.RetryBackoff, 500*time.Millisecond)
+	setter.SetDefault(&conf.MaxRetryBackoff, 30*time.Second)
+	setter.SetDefault(&conf.CloseTimeout, 10*time.Second)
+
+	h := HTTPHook{
+		queue: make(chan Item, conf.BufferSize),
+		conf:  conf,
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(conf.FlushInterval)
+		defer ticker.Stop()
+
+		var batch []Item
+		var size int
+		send := func() {
+			if len(batch) == 0 {
+				return
+			}
+			h.setError(h.send(batch))
+			batch, size = nil, 0
+		}
+
+		for {
+			select {
+			case item, ok := <-h.queue:
+				if !ok {
+					send()
+					return
+				}
+				if size+len(item.Data) > conf.BatchBytes {
+					send()
+				}
+				batch = append(batch, item)
+				size += len(item.Data)
+				if len(batch) >= conf.BatchSize {
+					send()
+				}
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+	return &h, nil
+}
+
+func (h *HTTPHook) Fire(entry *logrus.Entry) error {
+	buf, err := h.conf.Formatter.Format(entry)
+	if err != nil {
+		return errors.Wrap(err, "while formatting entry")
+	}
+
+	if h.debug {
+		fmt.Printf("%s\n", string(buf))
+	}
+
+	h.closeMutex.RLock()
+	defer h.closeMutex.RUnlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+
+	select {
+	case h.queue <- Item{Time: entry.Time, Level: entry.Level, Data: buf}:
+	default:
+		// If the queue is full, then we better drop a log record than
+		// block program execution.
+		atomic.AddInt64(&h.overflows, 1)
+		_, _ = fmt.Fprintf(os.Stderr, "[httphook] buffer overflow: %s\n", string(buf))
+	}
+	return nil
+}
+
+// Posts the batch, retrying with backoff on 429, 5xx and network errors
+func (h *HTTPHook) send(batch []Item) error {
+	body, contentType, err := h.conf.Encoder.Encode(batch)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "[httphook] encode error '%s', dropped %d records\n", err, len(batch))
+		return errors.Wrap(err, "while encoding batch")
+	}
+
+	if h.conf.Gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(body)
+		if err := w.Close(); err != nil {
+			return errors.Wrap(err, "while compressing batch")
+		}
+		body = buf.Bytes()
+	}
+
+	backoff := h.conf.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = h.post(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt >= h.conf.MaxRetries {
+			break
+		}
+
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > h.conf.MaxRetryBackoff {
+			wait = h.conf.MaxRetryBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-h.ctx.Done():
+			timer.Stop()
+			_, _ = fmt.Fprintf(os.Stderr, "[httphook] close timeout, dropped %d records\n", len(batch))
+			return errors.Wrap(err, "close timeout")
+		}
+		backoff *= 2
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "[httphook] post error '%s', dropped %d records\n", err, len(batch))
+	return err
+}
+
+// Posts the body, returns the wait requested by the server before the next
+// attempt or a negative duration if the request should not be retried
+func (h *HTTPHook) post(body []byte, contentType string) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, h.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, errors.Wrap(err, "while creating request")
+	}
+	req = req.WithContext(h.ctx)
+	for key, values := range h.conf.Headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.conf.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if h.conf.Username != "" {
+		req.SetBasicAuth(h.conf.Username, h.conf.Password)
+	}
+	if h.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.conf.BearerToken)
+	}
+
+	resp, err := h.conf.Client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "while posting batch")
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, fmt.Errorf("server returned '%s': %s", resp.Status, msg)
+	}
+	return -1, fmt.Errorf("server returned '%s': %s", resp.Status, msg)
+}
+
+func (h *HTTPHook) setError(err error) {
+	h.mutex.Lock()
+	h.lastErr = err
+	h.mutex.Unlock()
+}
+
+// Levels returns the available logging levels.
+func (h *HTTPHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *HTTPHook) SetDebug(set bool) {
+	h.debug = set
+}
+
+// Overflows returns the number of records dropped because the buffer was full
+func (h *HTTPHook) Overflows() int64 {
+	return atomic.LoadInt64(&h.overflows)
+}
+
+// Close the hook and flush any remaining logs. Posts and retries still
+// pending after Config.CloseTimeout are aborted. Returns the error of the
+// last batch sent, if any.
+func (h *HTTPHook) Close() error {
+	h.once.Do(func() {
+		h.closeMutex.Lock()
+		h.closed = true
+		close(h.queue)
+		h.closeMutex.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			h.wg.Wait()
+			close(done)
+		}()
+		timer := time.NewTimer(h.conf.CloseTimeout)
+		select {
+		case <-done:
+		case <-timer.C:
+			h.cancel()
+			<-done
+		}
+		timer.Stop()
+		h.cancel()
+	})
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.lastErr
+}
@@ -0,0 +1,290 @@
+package httphook_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/httphook"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestHTTPHook(t *testing.T) { TestingT(t) }
+
+type request struct {
+	Header http.Header
+	Body   []byte
+}
+
+// Records the requests received and replies with the queued status codes
+type collector struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func newCollector(statuses ...int) *collector {
+	col := &collector{statuses: statuses}
+	col.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		buf, _ := ioutil.ReadAll(body)
+
+		col.mutex.Lock()
+		defer col.mutex.Unlock()
+		status := http.StatusOK
+		if len(col.statuses) != 0 {
+			status, col.statuses = col.statuses[0], col.statuses[1:]
+		}
+		col.requests = append(col.requests, request{Header: r.Header, Body: buf})
+		w.WriteHeader(status)
+	}))
+	return col
+}
+
+func (col *collector) Requests() []request {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+	return append([]request{}, col.requests...)
+}
+
+// Returns the records of a ndjson body
+func lines(c *C, body []byte) []map[string]interface{} {
+	var result []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		c.Assert(json.Unmarshal(scanner.Bytes(), &rec), IsNil)
+		result = append(result, rec)
+	}
+	return result
+}
+
+type HTTPHookTests struct {
+	col *collector
+	log *logrus.Logger
+}
+
+var _ = Suite(&HTTPHookTests{})
+
+func (s *HTTPHookTests) SetUpTest(c *C) {
+	s.col = newCollector()
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+}
+
+func (s *HTTPHookTests) TearDownTest(c *C) {
+	s.col.server.Close()
+}
+
+func (s *HTTPHookTests) newHook(c *C, conf httphook.Config) *httphook.HTTPHook {
+	conf.URL = s.col.server.URL
+	hook, err := httphook.New(conf)
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+	return hook
+}
+
+func (s *HTTPHookTests) TestBatchSize(c *C) {
+	hook := s.newHook(c, httphook.Config{BatchSize: 2, FlushInterval: time.Hour})
+
+	s.log.Info("one")
+	s.log.Info("two")
+	s.log.Info("three")
+	c.Assert(hook.Close(), IsNil)
+
+	reqs := s.col.Requests()
+	c.Assert(len(reqs), Equals, 2)
+	c.Assert(reqs[0].Header.Get("Content-Type"), Equals, "application/x-ndjson")
+
+	recs := lines(c, reqs[0].Body)
+	c.Assert(len(recs), Equals, 2)
+	c.Assert(recs[0]["message"], Equals, "one")
+	c.Assert(recs[1]["message"], Equals, "two")
+
+	recs = lines(c, reqs[1].Body)
+	c.Assert(len(recs), Equals, 1)
+	c.Assert(recs[0]["message"], Equals, "three")
+}
+
+func (s *HTTPHookTests) TestBatchBytes(c *C) {
+	hook := s.newHook(c, httphook.Config{BatchBytes: 10, FlushInterval: time.Hour})
+
+	s.log.Info("one")
+	s.log.Info("two")
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(len(s.col.Requests()), Equals, 2)
+}
+
+func (s *HTTPHookTests) TestFlushInterval(c *C) {
+	hook := s.newHook(c, httphook.Config{FlushInterval: 10 * time.Millisecond})
+	defer hook.Close()
+
+	s.log.Info("one")
+	for i := 0; i < 100 && len(s.col.Requests()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(len(s.col.Requests()), Equals, 1)
+}
+
+func (s *HTTPHookTests) TestGzipAndAuth(c *C) {
+	hook := s.newHook(c, httphook.Config{
+		Gzip:        true,
+		BearerToken: "token",
+		Headers:     http.Header{"X-Custom": []string{"value"}},
+	})
+
+	s.log.Info("one")
+	c.Assert(hook.Close(), IsNil)
+
+	reqs := s.col.Requests()
+	c.Assert(len(reqs), Equals, 1)
+	c.Assert(reqs[0].Header.Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(reqs[0].Header.Get("Authorization"), Equals, "Bearer token")
+	c.Assert(reqs[0].Header.Get("X-Custom"), Equals, "value")
+	c.Assert(lines(c, reqs[0].Body)[0]["message"], Equals, "one")
+}
+
+func (s *HTTPHookTests) TestBasicAuth(c *C) {
+	hook := s.newHook(c, httphook.Config{Username: "user", Password: "pass"})
+
+	s.log.Info("one")
+	c.Assert(hook.Close(), IsNil)
+
+	reqs := s.col.Requests()
+	c.Assert(len(reqs), Equals, 1)
+	c.Assert(reqs[0].Header.Get("Authorization"), Equals, "Basic dXNlcjpwYXNz")
+}
+
+func (s *HTTPHookTests) TestRetry(c *C) {
+	s.col.statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	hook := s.newHook(c, httphook.Config{RetryBackoff: time.Millisecond})
+
+	s.log.Info("one")
+	c.Assert(hook.Close(), IsNil)
+
+	reqs := s.col.Requests()
+	c.Assert(len(reqs), Equals, 3)
+	c.Assert(bytes.Equal(reqs[0].Body, reqs[2].Body), Equals, true)
+}
+
+func (s *HTTPHookTests) TestNoRetryOnClientError(c *C) {
+	s.col.statuses = []int{http.StatusBadRequest}
+	hook := s.newHook(c, httphook.Config{RetryBackoff: time.Millisecond})
+
+	s.log.Info("one")
+	c.Assert(hook.Close(), ErrorMatches, "server returned '400 Bad Request'.*")
+	c.Assert(len(s.col.Requests()), Equals, 1)
+}
+
+func (s *HTTPHookTests) TestMaxRetries(c *C) {
+	s.col.statuses = []int{500, 500, 500}
+	hook := s.newHook(c, httphook.Config{MaxRetries: 1, RetryBackoff: time.Millisecond})
+
+	s.log.Info("one")
+	c.Assert(hook.Close(), NotNil)
+	c.Assert(len(s.col.Requests()), Equals, 2)
+}
+
+func (s *HTTPHookTests) TestCloseTimeout(c *C) {
+	s.col.statuses = []int{500, 500, 500}
+	hook := s.newHook(c, httphook.Config{
+		RetryBackoff: time.Minute,
+		CloseTimeout: 50 * time.Millisecond,
+	})
+
+	s.log.Info("one")
+	start := time.Now()
+	c.Assert(hook.Close(), ErrorMatches, "close timeout: server returned '500 Internal Server Error'.*")
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+	c.Assert(len(s.col.Requests()), Equals, 1)
+}
+
+func (s *HTTPHookTests) TestFireAfterClose(c *C) {
+	hook := s.newHook(c, httphook.Config{})
+	c.Assert(hook.Close(), IsNil)
+
+	err := hook.Fire(logrus.NewEntry(s.log))
+	c.Assert(err, ErrorMatches, "hook is closed")
+}
+
+func (s *HTTPHookTests) TestURLRequired(c *C) {
+	_, err := httphook.New(httphook.Config{})
+	c.Assert(err, ErrorMatches, "URL is required")
+}
+
+type EncoderTests struct {
+	batch []httphook.Item
+}
+
+var _ = Suite(&EncoderTests{})
+
+func (s *EncoderTests) SetUpTest(c *C) {
+	ts := time.Unix(1500000000, 500000000)
+	s.batch = []httphook.Item{
+		{Time: ts, Level: logrus.InfoLevel, Data: []byte(`{"message":"one"}` + "\n")},
+		{Time: ts, Level: logrus.WarnLevel, Data: []byte(`{"message":"two"}` + "\n")},
+	}
+}
+
+func (s *EncoderTests) TestEncoders(c *C) {
+	tests := []struct {
+		encoder     httphook.Encoder
+		contentType string
+		body        string
+	}{
+		{
+			encoder:     httphook.NDJSONEncoder{},
+			contentType: "application/x-ndjson",
+			body:        "{\"message\":\"one\"}\n{\"message\":\"two\"}\n",
+		},
+		{
+			encoder:     httphook.JSONArrayEncoder{},
+			contentType: "application/json",
+			body:        `[{"message":"one"},{"message":"two"}]`,
+		},
+		{
+			encoder:     httphook.ElasticsearchEncoder{Index: "logs"},
+			contentType: "application/x-ndjson",
+			body: "{\"index\":{\"_index\":\"logs\"}}\n{\"message\":\"one\"}\n" +
+				"{\"index\":{\"_index\":\"logs\"}}\n{\"message\":\"two\"}\n",
+		},
+		{
+			encoder:     httphook.SplunkEncoder{Index: "main", SourceType: "_json"},
+			contentType: "application/json",
+			body: `{"time":1500000000.500,"index":"main","sourcetype":"_json","event":{"message":"one"}}` +
+				`{"time":1500000000.500,"index":"main","sourcetype":"_json","event":{"message":"two"}}`,
+		},
+		{
+			encoder:     httphook.LokiEncoder{Labels: map[string]string{"app": "test"}},
+			contentType: "application/json",
+			body: `{"streams":[{"stream":{"app":"test"},"values":[` +
+				`["1500000000500000000","{\"message\":\"one\"}"],` +
+				`["1500000000500000000","{\"message\":\"two\"}"]]}]}`,
+		},
+	}
+	for i, tt := range tests {
+		c.Logf("Test case #%d", i)
+		body, contentType, err := tt.encoder.Encode(s.batch)
+		c.Assert(err, IsNil)
+		c.Assert(contentType, Equals, tt.contentType)
+		c.Assert(string(body), Equals, tt.body)
+	}
+}
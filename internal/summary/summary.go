@@ -0,0 +1,123 @@
+// Package summary forwards the summary records of the wrappers which collapse
+// records, ie ratelimit and deduphook
+package summary
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Collect returns the summaries of the windows which ended, or of every
+// window if all is true
+type Collect func(all bool) []*logrus.Entry
+
+// Forwarder forwards the summaries returned by Collect to the wrapped hook
+// every interval, when flushed and when closed. The wrapped hook is not
+// called while a lock is held so summaries and records are fired
+// concurrently.
+type Forwarder struct {
+	name    string
+	hook    logrus.Hook
+	collect Collect
+
+	// Sync stuff
+	mutex  sync.Locker
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New starts forwarding the summaries of the windows which ended every
+// interval. The name prefixes the errors written to stderr. The mutex guards
+// the windows of the wrapper, Close() holds it while the Forwarder is marked
+// closed.
+func New(name string, hook logrus.Hook, interval time.Duration, mutex sync.Locker, collect Collect) *Forwarder {
+	f := Forwarder{
+		name:    name,
+		hook:    hook,
+		collect: collect,
+		mutex:   mutex,
+		done:    make(chan struct{}),
+	}
+
+	ticker := clock.NewTicker(interval)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if err := f.Forward(f.collect(false)...); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "[%s] while sending summaries: %s\n", f.name, err)
+				}
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	return &f
+}
+
+// Forward fires the summaries on the wrapped hook in the order of their time
+// and message. The errors of the hook are combined.
+func (f *Forwarder) Forward(summaries ...*logrus.Entry) error {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Time.Equal(summaries[j].Time) {
+			return summaries[i].Message < summaries[j].Message
+		}
+		return summaries[i].Time.Before(summaries[j].Time)
+	})
+
+	var msgs []string
+	for _, summary := range summaries {
+		if err := f.hook.Fire(summary); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// Flush forwards the summaries of every window
+func (f *Forwarder) Flush() error {
+	return f.Forward(f.collect(true)...)
+}
+
+// Closed returns true once Close has been called, the caller must hold the mutex
+func (f *Forwarder) Closed() bool {
+	return f.closed
+}
+
+// Close stops the ticker, forwards the summaries of every window then closes
+// the wrapped hook if it has a `Close() error` method
+func (f *Forwarder) Close() error {
+	f.mutex.Lock()
+	if f.closed {
+		f.mutex.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.mutex.Unlock()
+
+	close(f.done)
+	f.wg.Wait()
+
+	err := f.Flush()
+	if closer, ok := f.hook.(interface{ Close() error }); ok {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
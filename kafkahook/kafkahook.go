@@ -6,20 +6,26 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Shopify/sarama"
 	"github.com/mailgun/holster/v3/errors"
-	"github.com/mailgun/holster/v3/setter"
-	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
 	"github.com/sirupsen/logrus"
 )
 
 const bufferSize = 150
 
 type KafkaHook struct {
+	// Accessed atomically, first for 64 bit alignment on 32 bit platforms
+	overflows     int64
+	produceErrors int64
+
 	produce chan []byte
 	conf    Config
 	debug   bool
@@ -34,6 +40,9 @@ type Config struct {
 	Topic     string
 	Producer  sarama.AsyncProducer
 	Formatter logrus.Formatter
+	// If no Formatter is provided, the formatter for this encoding is
+	// used, defaults to encoding.JSON
+	Encoding encoding.Encoding
 }
 
 func NewWithContext(ctx context.Context, conf Config) (hook *KafkaHook, err error) {
@@ -53,10 +62,15 @@ func NewWithContext(ctx context.Context, conf Config) (hook *KafkaHook, err erro
 }
 
 func New(conf Config) (*KafkaHook, error) {
-	// If no formatter defined, use the default
-	setter.SetDefault(&conf.Formatter, common.DefaultFormatter)
 	var err error
 
+	// If no formatter defined, use the formatter for the encoding
+	if conf.Formatter == nil {
+		if conf.Formatter, err = encoding.NewFormatter(conf.Encoding); err != nil {
+			return nil, errors.Wrap(err, "kafka formatter error")
+		}
+	}
+
 	kafkaConfig := sarama.NewConfig()
 	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
 	kafkaConfig.Producer.Compression = sarama.CompressionSnappy
@@ -83,8 +97,9 @@ func New(conf Config) (*KafkaHook, error) {
 		for {
 			select {
 			case err := <-conf.Producer.Errors():
+				atomic.AddInt64(&h.produceErrors, 1)
 				msg, _ := err.Msg.Value.Encode()
-				_, _ = fmt.Fprintf(os.Stderr, "[kafkahook] produce error '%s' for: %s\n", err.Err, string(msg))
+				_, _ = fmt.Fprintf(os.Stderr, "[kafkahook] produce error '%s' for: %s\n", err.Err, h.printable(msg))
 
 			case buf, ok := <-h.produce:
 				if !ok {
@@ -112,7 +127,7 @@ func (h *KafkaHook) Fire(entry *logrus.Entry) error {
 	}
 
 	if h.debug {
-		fmt.Printf("%s\n", string(buf))
+		fmt.Printf("%s\n", h.printable(buf))
 	}
 
 	err = h.sendKafka(buf)
@@ -128,11 +143,30 @@ func (h *KafkaHook) sendKafka(buf []byte) error {
 	default:
 		// If the producer input channel buffer is full, then we better drop
 		// a log record than block program execution.
-		_, _ = fmt.Fprintf(os.Stderr, "[kafkahook] buffer overflow: %s\n", string(buf))
+		atomic.AddInt64(&h.overflows, 1)
+		_, _ = fmt.Fprintf(os.Stderr, "[kafkahook] buffer overflow: %s\n", h.printable(buf))
 	}
 	return nil
 }
 
+// Returns the record for printing, binary records are decoded to JSON. Records
+// which can not be decoded are quoted.
+func (h *KafkaHook) printable(buf []byte) string {
+	switch h.conf.Encoding {
+	case "", encoding.JSON:
+	default:
+		if rec, err := encoding.Decode(h.conf.Encoding, buf); err == nil {
+			if buf, err := rec.MarshalJSON(); err == nil {
+				return string(buf)
+			}
+		}
+	}
+	if utf8.Valid(buf) {
+		return strings.TrimSpace(string(buf))
+	}
+	return strconv.Quote(string(buf))
+}
+
 // Given an io reader send the contents of the reader to udplog
 func (h *KafkaHook) SendIO(input io.Reader) error {
 	// Append our identifier
@@ -162,6 +196,17 @@ func (h *KafkaHook) SetDebug(set bool) {
 	h.debug = set
 }
 
+// Overflows returns the number of records dropped because the buffer was full
+func (h *KafkaHook) Overflows() int64 {
+	return atomic.LoadInt64(&h.overflows)
+}
+
+// Errors returns the number of records kafka failed to produce. Fire() does
+// not return these errors as records are produced asynchronously.
+func (h *KafkaHook) Errors() int64 {
+	return atomic.LoadInt64(&h.produceErrors)
+}
+
 // Close the kakfa producer and flush any remaining logs
 func (h *KafkaHook) Close() error {
 	var err error
@@ -1,11 +1,14 @@
 package kafkahook_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/Shopify/sarama/mocks"
 	"github.com/mailgun/holster/v3/errors"
 	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
 	"github.com/mailgun/logrus-hooks/kafkahook"
 	"github.com/sirupsen/logrus"
 	. "gopkg.in/check.v1"
@@ -92,7 +96,7 @@ func (s *KafkaHookTests) TestKafkaHookContext(c *C) {
 
 	req := GetMsg(s.producer)
 	c.Assert(req["message"], Equals, "this is a test")
-	c.Assert(req["lineno"], Equals, float64(91))
+	c.Assert(req["lineno"], Equals, float64(95))
 	c.Assert(req["logLevel"], Equals, "ERROR")
 	c.Assert(strings.Contains(req["filename"].(string),
 		"kafkahook/kafkahook_test.go"),
@@ -159,7 +163,7 @@ func (s *KafkaHookTests) TestFromErr(c *C) {
 	c.Assert(strings.Contains(req["filename"].(string),
 		"kafkahook/kafkahook_test.go"),
 		Equals, true, Commentf(req["filename"].(string)))
-	c.Assert(req["lineno"], Equals, float64(154))
+	c.Assert(req["lineno"], Equals, float64(158))
 	c.Assert(req["funcName"], Equals, "kafkahook_test.(*KafkaHookTests).TestFromErr")
 	c.Assert(req["excType"], Equals, "*errors.fundamental")
 	c.Assert(req["excValue"], Equals, "bar: foo")
@@ -167,6 +171,84 @@ func (s *KafkaHookTests) TestFromErr(c *C) {
 	c.Assert(strings.Contains(req["excText"].(string), "kafkahook/kafkahook_test.go"), Equals, true)
 }
 
+func (s *KafkaHookTests) TestKafkaHookEncoding(c *C) {
+	conf := sarama.NewConfig()
+	conf.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(c, conf)
+	producer.ExpectInputAndSucceed()
+
+	hook, err := kafkahook.New(kafkahook.Config{
+		Producer: producer,
+		Topic:    "test",
+		Encoding: encoding.MsgPack,
+	})
+	c.Assert(err, IsNil)
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(hook)
+	log.WithField("domain", "example.com").Info("this is a test")
+
+	msg := <-producer.Successes()
+	buf, _ := msg.Value.Encode()
+	rec, err := encoding.DecodeMsgPack(buf)
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "this is a test")
+	c.Assert(rec.LogLevel, Equals, "INFO")
+	c.Assert(rec.Context["domain"], Equals, "example.com")
+	c.Assert(rec.FuncName, Equals, "kafkahook_test.(*KafkaHookTests).TestKafkaHookEncoding")
+
+	_, err = kafkahook.New(kafkahook.Config{Producer: producer, Encoding: "xml"})
+	c.Assert(err, ErrorMatches, "kafka formatter error: unknown encoding 'xml'")
+}
+
+func (s *KafkaHookTests) TestKafkaHookProduceErrorBinary(c *C) {
+	r, w, err := os.Pipe()
+	c.Assert(err, IsNil)
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	producer := mocks.NewAsyncProducer(c, sarama.NewConfig())
+	producer.ExpectInputAndFail(errors.New("broker down"))
+	hook, err := kafkahook.New(kafkahook.Config{
+		Producer: producer,
+		Topic:    "test",
+		Encoding: encoding.MsgPack,
+	})
+	c.Assert(err, IsNil)
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(hook)
+	log.Info("this is a test")
+
+	// Binary records are printed as JSON
+	line, err := bufio.NewReader(r).ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Assert(line, Matches, `\[kafkahook\] produce error 'broker down' for: \{.*"message":"this is a test".*\}\n`)
+	c.Assert(hook.Errors(), Equals, int64(1))
+	c.Assert(hook.Close(), IsNil)
+}
+
+func (s *KafkaHookTests) TestKafkaHookCorrelation(c *C) {
+	ctx := common.ContextWithCorrelation(context.Background(), common.Correlation{SessionID: "sess-1"})
+	s.log.WithContext(ctx).WithFields(logrus.Fields{
+		"tid":        "0af7651916cd43dd8448eb211c80319c",
+		"request_id": "req-1",
+	}).Info("this is a test")
+
+	req := GetMsg(s.producer)
+	c.Assert(req["tid"], Equals, "0af7651916cd43dd8448eb211c80319c")
+	c.Assert(req["sessionId"], Equals, "sess-1")
+	// Other correlation names are only recorded in the correlation fields
+	// with FieldOptions.CorrelationFields
+	c.Assert(common.Exists(req, "requestId"), Equals, false)
+	c.Assert(req["context"], DeepEquals, map[string]interface{}{"request_id": "req-1"})
+	// Empty correlation fields are omitted
+	c.Assert(common.Exists(req, "userId"), Equals, false)
+}
+
 func GetMsg(producer *mocks.AsyncProducer) map[string]interface{} {
 	var result map[string]interface{}
 	msg := <-producer.Successes()
@@ -0,0 +1,197 @@
+package levelfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler is an http.Handler which lists the registered level filters and
+// changes their levels. Mount it with the prefix stripped
+//
+//	mux.Handle("/levels/", http.StripPrefix("/levels", handler))
+//
+// Then
+//
+//	GET /levels              lists every filter
+//	GET /levels/<name>       returns a filter
+//	PUT /levels/<name>       sets the level from `{"level": "debug", "ttl": "10m"}`
+//
+// If a TTL is given the level reverts to the previous level when it expires.
+type Handler struct {
+	mutex   sync.Mutex
+	filters map[string]*registered
+}
+
+// FilterStatus is the state of a filter returned by the handler
+type FilterStatus struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	// The level restored when the TTL expires
+	RevertLevel string `json:"revertLevel,omitempty"`
+	// When the level reverts
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+type setRequest struct {
+	Level string `json:"level"`
+	TTL   string `json:"ttl"`
+}
+
+type registered struct {
+	filter  *LevelFilter
+	base    logrus.Level
+	timer   *time.Timer
+	expires time.Time
+}
+
+func NewHandler() *Handler {
+	return &Handler{filters: make(map[string]*registered)}
+}
+
+// Register adds the filter to the handler under the name
+func (h *Handler) Register(name string, lf *LevelFilter) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if r, ok := h.filters[name]; ok && r.timer != nil {
+		r.timer.Stop()
+	}
+	h.filters[name] = &registered{filter: lf, base: lf.GetLevel()}
+}
+
+// SetLevel sets the level of the named filter. If ttl is not zero the level
+// reverts to the previous level after the ttl.
+func (h *Handler) SetLevel(name string, level logrus.Level, ttl time.Duration) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r, ok := h.filters[name]
+	if !ok {
+		return fmt.Errorf("no filter named '%s'", name)
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+		r.expires = time.Time{}
+	}
+	r.filter.SetLevel(level)
+	if ttl <= 0 {
+		r.base = level
+		return nil
+	}
+
+	r.expires = time.Now().Add(ttl)
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		// Ignore a timer replaced by a later SetLevel()
+		if r.timer != timer {
+			return
+		}
+		r.filter.SetLevel(r.base)
+		r.timer = nil
+		r.expires = time.Time{}
+	})
+	r.timer = timer
+	return nil
+}
+
+// Status returns the state of every filter sorted by name
+func (h *Handler) Status() []FilterStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	result := make([]FilterStatus, 0, len(h.filters))
+	for name := range h.filters {
+		result = append(result, h.status(name))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Returns the state of the filter, the caller must hold the mutex
+func (h *Handler) status(name string) FilterStatus {
+	r := h.filters[name]
+	status := FilterStatus{
+		Name:  name,
+		Level: r.filter.GetLevel().String(),
+	}
+	if r.timer != nil {
+		expires := r.expires
+		status.Expires = &expires
+		status.RevertLevel = r.base.String()
+	}
+	return status
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(req.URL.Path, "/")
+
+	switch {
+	case name == "" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.Status())
+		return
+	case name == "":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.mutex.Lock()
+	_, ok := h.filters[name]
+	h.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no filter named '%s'", name))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body setRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+			return
+		}
+		level, err := logrus.ParseLevel(body.Level)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var ttl time.Duration
+		if body.TTL != "" {
+			if ttl, err = time.ParseDuration(body.TTL); err != nil || ttl <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl '%s'", body.TTL))
+				return
+			}
+		}
+		if err := h.SetLevel(name, level, ttl); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.mutex.Lock()
+	status := h.status(name)
+	h.mutex.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -1,30 +1,47 @@
 package levelfilter
 
-import "github.com/sirupsen/logrus"
+import (
+	"sync/atomic"
 
+	"github.com/sirupsen/logrus"
+)
+
+// LevelFilter forwards entries with a level of the same or higher severity
+// than its threshold to the wrapped hook. The threshold can be changed with
+// SetLevel() while entries are being logged.
 type LevelFilter struct {
-	hook   logrus.Hook
-	levels []logrus.Level
+	hook  logrus.Hook
+	level uint32
 }
 
 func New(hook logrus.Hook, level logrus.Level) *LevelFilter {
-	levels := make([]logrus.Level, 0, len(logrus.AllLevels))
-	for _, l := range hook.Levels() {
-		if l <= level {
-			levels = append(levels, l)
-		}
-	}
-
 	return &LevelFilter{
-		hook:   hook,
-		levels: levels,
+		hook:  hook,
+		level: uint32(level),
 	}
 }
 
+// Levels returns every level the wrapped hook accepts, so lowering the
+// threshold takes effect without registering the hook again. Entries are
+// only created for levels enabled on the logrus logger, so the logger level
+// must be at least as verbose as the lowest threshold.
 func (lf *LevelFilter) Levels() []logrus.Level {
-	return lf.levels
+	return lf.hook.Levels()
+}
+
+// SetLevel changes the threshold of the filter
+func (lf *LevelFilter) SetLevel(level logrus.Level) {
+	atomic.StoreUint32(&lf.level, uint32(level))
+}
+
+// GetLevel returns the current threshold of the filter
+func (lf *LevelFilter) GetLevel() logrus.Level {
+	return logrus.Level(atomic.LoadUint32(&lf.level))
 }
 
 func (lf *LevelFilter) Fire(entry *logrus.Entry) error {
+	if entry.Level > lf.GetLevel() {
+		return nil
+	}
 	return lf.hook.Fire(entry)
 }
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
@@ -21,8 +24,8 @@ type LevelFilterSuite struct{}
 
 var _ = Suite(&LevelFilterSuite{})
 
-// Only levels with higher or the same severity are advertised by a level
-// filtering hook.
+// Every level of the underlying hook is advertised by a level filtering hook,
+// but only levels with higher or the same severity are forwarded.
 func (s *LevelFilterSuite) TestLevels(c *C) {
 	for i, tc := range []struct {
 		original []logrus.Level
@@ -68,8 +71,12 @@ func (s *LevelFilterSuite) TestLevels(c *C) {
 
 		fakeHook := newFakeHook(tc.original)
 		lf := New(fakeHook, tc.level)
+		c.Assert(lf.Levels(), DeepEquals, tc.original)
 
-		c.Assert(lf.Levels(), DeepEquals, tc.filtered)
+		for _, level := range tc.original {
+			lf.Fire(&logrus.Entry{Level: level})
+		}
+		c.Assert(fakeHook.Fired(), DeepEquals, tc.filtered)
 	}
 }
 
@@ -91,6 +98,45 @@ func (s *LevelFilterSuite) TestFire(c *C) {
 	c.Assert(fakeHook.entries, DeepEquals, []*logrus.Entry{e1, e2, e3})
 }
 
+// The threshold can be changed while entries are logged.
+func (s *LevelFilterSuite) TestSetLevel(c *C) {
+	fakeHook := newFakeHook(logrus.AllLevels)
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.SetLevel(logrus.DebugLevel)
+
+	lf := New(fakeHook, logrus.WarnLevel)
+	log.Hooks.Add(lf)
+	c.Assert(lf.GetLevel(), Equals, logrus.WarnLevel)
+
+	// When
+	log.Info("1")
+	lf.SetLevel(logrus.DebugLevel)
+	log.Debug("2")
+	lf.SetLevel(logrus.ErrorLevel)
+	log.Warn("3")
+	log.Error("4")
+
+	// Then
+	c.Assert(lf.GetLevel(), Equals, logrus.ErrorLevel)
+	c.Assert(fakeHook.Fired(), DeepEquals, []logrus.Level{logrus.DebugLevel, logrus.ErrorLevel})
+}
+
+func (s *LevelFilterSuite) TestSetLevelConcurrent(c *C) {
+	lf := New(newFakeHook(logrus.AllLevels), logrus.InfoLevel)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			lf.SetLevel(logrus.AllLevels[i%len(logrus.AllLevels)])
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		lf.Fire(&logrus.Entry{Level: logrus.InfoLevel})
+	}
+	<-done
+}
+
 func (s *LevelFilterSuite) TestCallerInfoWithError(c *C) {
 	kafkaHook, msgGetter := newKafkaHook(c)
 	log := logrus.New()
@@ -146,6 +192,15 @@ func (h *fakeHook) Levels() []logrus.Level {
 	return h.levels
 }
 
+// Returns the levels of the entries fired
+func (h *fakeHook) Fired() []logrus.Level {
+	var result []logrus.Level
+	for _, e := range h.entries {
+		result = append(result, e.Level)
+	}
+	return result
+}
+
 func (h *fakeHook) Fire(entry *logrus.Entry) error {
 	h.entries = append(h.entries, entry)
 	return nil
@@ -184,3 +239,107 @@ func getMsg(producer *mocks.AsyncProducer) map[string]interface{} {
 	}
 	return result
 }
+
+type HandlerSuite struct {
+	kafka   *LevelFilter
+	file    *LevelFilter
+	handler *Handler
+}
+
+var _ = Suite(&HandlerSuite{})
+
+func (s *HandlerSuite) SetUpTest(c *C) {
+	s.kafka = New(newFakeHook(logrus.AllLevels), logrus.InfoLevel)
+	s.file = New(newFakeHook(logrus.AllLevels), logrus.WarnLevel)
+	s.handler = NewHandler()
+	s.handler.Register("kafka", s.kafka)
+	s.handler.Register("file", s.file)
+}
+
+func (s *HandlerSuite) do(c *C, method, path, body string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json")
+	var result map[string]interface{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &result), IsNil)
+	return w.Code, result
+}
+
+func (s *HandlerSuite) TestList(c *C) {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var result []FilterStatus
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &result), IsNil)
+	c.Assert(result, DeepEquals, []FilterStatus{
+		{Name: "file", Level: "warning"},
+		{Name: "kafka", Level: "info"},
+	})
+}
+
+func (s *HandlerSuite) TestGetAndPut(c *C) {
+	code, result := s.do(c, "GET", "/kafka", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(result["level"], Equals, "info")
+
+	code, result = s.do(c, "PUT", "/kafka", `{"level": "debug"}`)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(result["level"], Equals, "debug")
+	c.Assert(result["expires"], IsNil)
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.DebugLevel)
+	c.Assert(s.file.GetLevel(), Equals, logrus.WarnLevel)
+}
+
+func (s *HandlerSuite) TestTTL(c *C) {
+	code, result := s.do(c, "PUT", "/kafka", `{"level": "debug", "ttl": "20ms"}`)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(result["level"], Equals, "debug")
+	c.Assert(result["revertLevel"], Equals, "info")
+	c.Assert(result["expires"], NotNil)
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.DebugLevel)
+
+	for i := 0; i < 100 && s.kafka.GetLevel() != logrus.InfoLevel; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.InfoLevel)
+	_, result = s.do(c, "GET", "/kafka", "")
+	c.Assert(result["expires"], IsNil)
+}
+
+func (s *HandlerSuite) TestTTLReplaced(c *C) {
+	c.Assert(s.handler.SetLevel("kafka", logrus.DebugLevel, 10*time.Millisecond), IsNil)
+	// A level without a TTL cancels the revert and becomes the new base level
+	c.Assert(s.handler.SetLevel("kafka", logrus.ErrorLevel, 0), IsNil)
+	time.Sleep(30 * time.Millisecond)
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.ErrorLevel)
+
+	c.Assert(s.handler.SetLevel("kafka", logrus.TraceLevel, 10*time.Millisecond), IsNil)
+	for i := 0; i < 100 && s.kafka.GetLevel() != logrus.ErrorLevel; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.ErrorLevel)
+}
+
+func (s *HandlerSuite) TestErrors(c *C) {
+	for i, tt := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		err    string
+	}{
+		{method: "GET", path: "/missing", code: 404, err: "no filter named 'missing'"},
+		{method: "PUT", path: "/kafka", body: `{"level": "loud"}`, code: 400, err: "not a valid logrus Level: \"loud\""},
+		{method: "PUT", path: "/kafka", body: `{"level": "debug", "ttl": "soon"}`, code: 400, err: "invalid ttl 'soon'"},
+		{method: "PUT", path: "/kafka", body: `level=debug`, code: 400, err: "invalid body: .*"},
+		{method: "DELETE", path: "/kafka", code: 405, err: "method not allowed"},
+		{method: "POST", path: "/", code: 405, err: "method not allowed"},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+		code, result := s.do(c, tt.method, tt.path, tt.body)
+		c.Assert(code, Equals, tt.code)
+		c.Assert(result["error"], Matches, tt.err)
+	}
+	c.Assert(s.kafka.GetLevel(), Equals, logrus.InfoLevel)
+}
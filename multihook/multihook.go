@@ -0,0 +1,302 @@
+package multihook
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorPolicy decides what happens when a sink fails
+type ErrorPolicy int
+
+const (
+	// Errors are written to stderr
+	ErrorLog ErrorPolicy = iota
+	// Errors are ignored
+	ErrorIgnore
+	// Errors are written to stderr and the sink is disabled for DisableFor
+	// after MaxErrors consecutive errors
+	ErrorDisable
+)
+
+// MultiHook fans out records to several hooks. Each hook is fed from its own
+// queue by its own goroutine, so a slow or failing hook does not delay the
+// caller or the other hooks.
+type MultiHook struct {
+	sinks  []*sink
+	levels []logrus.Level
+
+	// Sync stuff
+	mutex  sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Config struct {
+	Sinks []Sink
+}
+
+// Sink is a hook records are fanned out to
+type Sink struct {
+	// The name of the sink in errors and Stats(), defaults to the index of the sink
+	Name string
+	Hook logrus.Hook
+	// Levels sent to the sink, defaults to the levels of the hook. Levels the
+	// hook does not accept are never sent.
+	Levels []logrus.Level
+	// Number of records queued before new records are dropped, defaults to 1000
+	QueueSize int
+	// Maximum time the hook may take to fire a record, defaults to 5 seconds.
+	// A record which times out is counted as an error and the call is left
+	// running, records are dropped until the call returns.
+	Timeout time.Duration
+	// What happens when the hook returns an error, times out or the queue overflows
+	OnError ErrorPolicy
+	// Consecutive errors after which ErrorDisable disables the sink, defaults to 10
+	MaxErrors int
+	// How long ErrorDisable disables the sink, defaults to 1 minute. The next
+	// record is then sent to the hook, the sink is enabled again if it
+	// succeeds or disabled again if it fails.
+	DisableFor time.Duration
+}
+
+// SinkStats are the counters of a sink returned by Stats()
+type SinkStats struct {
+	Name     string
+	Queued   int
+	Sent     int64
+	Dropped  int64
+	Errors   int64
+	Disabled bool
+}
+
+type sink struct {
+	// Accessed atomically, first for 64 bit alignment on 32 bit platforms
+	sent     int64
+	dropped  int64
+	errors   int64
+	failures int64
+	// UnixNano until which the sink is disabled, 0 if enabled
+	disabledUntil int64
+
+	conf   Sink
+	levels map[logrus.Level]bool
+	queue  chan *logrus.Entry
+	// The result of a call which timed out and is still running, only
+	// accessed by the goroutine of the sink
+	pending chan error
+}
+
+func New(conf Config) (*MultiHook, error) {
+	if len(conf.Sinks) == 0 {
+		return nil, errors.New("at least one sink is required")
+	}
+
+	h := MultiHook{}
+	union := make(map[logrus.Level]bool)
+	for i, sc := range conf.Sinks {
+		if sc.Hook == nil {
+			return nil, fmt.Errorf("sink %d has no hook", i)
+		}
+		setter.SetDefault(&sc.Name, strconv.Itoa(i))
+		setter.SetDefault(&sc.Levels, sc.Hook.Levels())
+		setter.SetDefault(&sc.QueueSize, 1000)
+		setter.SetDefault(&sc.Timeout, 5*time.Second)
+		setter.SetDefault(&sc.MaxErrors, 10)
+		setter.SetDefault(&sc.DisableFor, time.Minute)
+
+		s := &sink{
+			conf:   sc,
+			levels: make(map[logrus.Level]bool),
+			queue:  make(chan *logrus.Entry, sc.QueueSize),
+		}
+		accepted := make(map[logrus.Level]bool)
+		for _, l := range sc.Hook.Levels() {
+			accepted[l] = true
+		}
+		for _, l := range sc.Levels {
+			if accepted[l] {
+				s.levels[l] = true
+				union[l] = true
+			}
+		}
+		h.sinks = append(h.sinks, s)
+
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for entry := range s.queue {
+				if s.enabled() {
+					s.fire(entry)
+				}
+			}
+		}()
+	}
+
+	for l := range union {
+		h.levels = append(h.levels, l)
+	}
+	sort.Slice(h.levels, func(i, j int) bool { return h.levels[i] < h.levels[j] })
+	return &h, nil
+}
+
+func (h *MultiHook) Fire(entry *logrus.Entry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+
+	// The copy holds the caller, so it is only captured once
+	var base *logrus.Entry
+	for _, s := range h.sinks {
+		if !s.levels[entry.Level] || !s.enabled() {
+			continue
+		}
+		if base == nil {
+			base = common.CopyEntry(entry)
+		}
+
+		// Each sink gets its own copy as hooks may modify the entry
+		select {
+		case s.queue <- common.CopyEntry(base):
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			s.fail(errors.New("queue overflow"))
+		}
+	}
+	return nil
+}
+
+// Returns false while the sink is disabled
+func (s *sink) enabled() bool {
+	until := atomic.LoadInt64(&s.disabledUntil)
+	return until == 0 || clock.Now().UnixNano() >= until
+}
+
+// Fires the entry on the hook of the sink, waiting at most the timeout. The
+// entry is dropped if a previous call which timed out is still running.
+func (s *sink) fire(entry *logrus.Entry) {
+	if s.pending != nil {
+		select {
+		case <-s.pending:
+			s.pending = nil
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			return
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- s.conf.Hook.Fire(entry)
+	}()
+
+	timer := time.NewTimer(s.conf.Timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timer.C:
+		s.pending = done
+		err = fmt.Errorf("timeout after %s", s.conf.Timeout)
+	}
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	atomic.AddInt64(&s.sent, 1)
+	atomic.StoreInt64(&s.failures, 0)
+	if atomic.SwapInt64(&s.disabledUntil, 0) != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "[multihook] sink '%s' enabled\n", s.conf.Name)
+	}
+}
+
+// Applies the error policy of the sink to the error
+func (s *sink) fail(err error) {
+	atomic.AddInt64(&s.errors, 1)
+	failures := atomic.AddInt64(&s.failures, 1)
+
+	switch s.conf.OnError {
+	case ErrorIgnore:
+		return
+	case ErrorDisable:
+		if failures >= int64(s.conf.MaxErrors) {
+			atomic.StoreInt64(&s.disabledUntil, clock.Now().Add(s.conf.DisableFor).UnixNano())
+			_, _ = fmt.Fprintf(os.Stderr, "[multihook] sink '%s' disabled for %s after %d errors: %s\n",
+				s.conf.Name, s.conf.DisableFor, failures, err)
+			return
+		}
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "[multihook] sink '%s' error: %s\n", s.conf.Name, err)
+}
+
+// Levels returns every level accepted by at least one sink
+func (h *MultiHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Stats returns the counters of each sink in the order they were configured
+func (h *MultiHook) Stats() []SinkStats {
+	result := make([]SinkStats, len(h.sinks))
+	for i, s := range h.sinks {
+		result[i] = SinkStats{
+			Name:     s.conf.Name,
+			Queued:   len(s.queue),
+			Sent:     atomic.LoadInt64(&s.sent),
+			Dropped:  atomic.LoadInt64(&s.dropped),
+			Errors:   atomic.LoadInt64(&s.errors),
+			Disabled: !s.enabled(),
+		}
+	}
+	return result
+}
+
+// Close waits for the queued records to be sent then closes every hook which
+// has a `Close() error` method. The errors of the hooks are combined.
+func (h *MultiHook) Close() error {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return nil
+	}
+	h.closed = true
+	for _, s := range h.sinks {
+		close(s.queue)
+	}
+	h.mutex.Unlock()
+
+	h.wg.Wait()
+
+	var msgs []string
+	for _, s := range h.sinks {
+		closer, ok := s.conf.Hook.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			msgs = append(msgs, fmt.Sprintf("sink '%s': %s", s.conf.Name, err))
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package multihook_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/multihook"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestMultiHook(t *testing.T) { TestingT(t) }
+
+// Records the messages fired, optionally blocking or failing
+type testHook struct {
+	levels  []logrus.Level
+	block   chan struct{}
+	err     error
+	mutex   sync.Mutex
+	records []*common.LogRecord
+	closed  bool
+}
+
+func (h *testHook) Levels() []logrus.Level {
+	if h.levels == nil {
+		return logrus.AllLevels
+	}
+	return h.levels
+}
+
+func (h *testHook) Fire(entry *logrus.Entry) error {
+	if h.block != nil {
+		<-h.block
+	}
+	rec := common.NewJSONFormater().Record(entry)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, rec)
+	return h.err
+}
+
+func (h *testHook) Messages() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var result []string
+	for _, rec := range h.records {
+		result = append(result, rec.Message)
+	}
+	return result
+}
+
+func (h *testHook) Close() error {
+	h.closed = true
+	return h.err
+}
+
+type MultiHookTests struct {
+	log *logrus.Logger
+}
+
+var _ = Suite(&MultiHookTests{})
+
+func (s *MultiHookTests) SetUpTest(c *C) {
+	s.log = logrus.New()
+	s.log.Out = ioutil.Discard
+}
+
+func (s *MultiHookTests) TestFanOut(c *C) {
+	first, second := &testHook{}, &testHook{}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Hook: first},
+		{Hook: second},
+	}})
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+
+	s.log.Info("one")
+	s.log.WithFields(logrus.Fields{"domain": "example.com"}).Warn("two")
+	c.Assert(hook.Close(), IsNil)
+
+	for _, h := range []*testHook{first, second} {
+		c.Assert(h.Messages(), DeepEquals, []string{"one", "two"})
+		c.Assert(h.records[0].FuncName, Equals, "multihook_test.(*MultiHookTests).TestFanOut")
+		c.Assert(h.records[1].Context["domain"], Equals, "example.com")
+		c.Assert(h.closed, Equals, true)
+	}
+}
+
+func (s *MultiHookTests) TestLevels(c *C) {
+	errorsOnly := &testHook{}
+	infoHook := &testHook{levels: []logrus.Level{logrus.ErrorLevel, logrus.InfoLevel}}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Hook: errorsOnly, Levels: []logrus.Level{logrus.ErrorLevel}},
+		// Levels the hook does not accept are never sent
+		{Hook: infoHook, Levels: []logrus.Level{logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel}},
+	}})
+	c.Assert(err, IsNil)
+	c.Assert(hook.Levels(), DeepEquals, []logrus.Level{logrus.ErrorLevel, logrus.InfoLevel})
+	s.log.Hooks.Add(hook)
+
+	s.log.Error("error")
+	s.log.Warn("warn")
+	s.log.Info("info")
+	c.Assert(hook.Close(), IsNil)
+
+	c.Assert(errorsOnly.Messages(), DeepEquals, []string{"error"})
+	c.Assert(infoHook.Messages(), DeepEquals, []string{"error", "info"})
+}
+
+func (s *MultiHookTests) TestIsolation(c *C) {
+	blocked := &testHook{block: make(chan struct{})}
+	failing := &testHook{err: errors.New("failed")}
+	healthy := &testHook{}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Name: "blocked", Hook: blocked, QueueSize: 1, Timeout: 10 * time.Millisecond, OnError: multihook.ErrorIgnore},
+		{Name: "failing", Hook: failing, OnError: multihook.ErrorIgnore},
+		{Name: "healthy", Hook: healthy},
+	}})
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		s.log.Info("record")
+	}
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+
+	close(blocked.block)
+	c.Assert(hook.Close(), ErrorMatches, "sink 'failing': failed")
+	c.Assert(len(healthy.Messages()), Equals, 10)
+
+	stats := hook.Stats()
+	c.Assert(stats[0].Name, Equals, "blocked")
+	c.Assert(stats[0].Dropped > 0, Equals, true)
+	c.Assert(stats[1].Errors, Equals, int64(10))
+	c.Assert(stats[2].Sent, Equals, int64(10))
+	c.Assert(stats[2].Errors, Equals, int64(0))
+}
+
+func (s *MultiHookTests) TestTimeout(c *C) {
+	blocked := &testHook{block: make(chan struct{})}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Hook: blocked, Timeout: 10 * time.Millisecond, OnError: multihook.ErrorIgnore},
+	}})
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+
+	// The hook is not called again while the call which timed out is running
+	s.log.Info("one")
+	s.log.Info("two")
+	for hook.Stats()[0].Dropped == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(blocked.block)
+	for len(blocked.Messages()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.log.Info("three")
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(blocked.Messages(), DeepEquals, []string{"one", "three"})
+	stats := hook.Stats()[0]
+	c.Assert(stats.Errors, Equals, int64(1))
+	c.Assert(stats.Dropped, Equals, int64(1))
+	c.Assert(stats.Sent, Equals, int64(1))
+}
+
+func (s *MultiHookTests) TestErrorDisable(c *C) {
+	failing := &testHook{err: errors.New("failed")}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Hook: failing, OnError: multihook.ErrorDisable, MaxErrors: 2},
+	}})
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+
+	for i := 0; i < 5; i++ {
+		s.log.Info("record")
+	}
+	hook.Close()
+
+	stats := hook.Stats()[0]
+	c.Assert(stats.Disabled, Equals, true)
+	c.Assert(stats.Errors, Equals, int64(2))
+	c.Assert(failing.Messages(), HasLen, 2)
+}
+
+func (s *MultiHookTests) TestErrorDisableRecovers(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+	failing := &testHook{err: errors.New("failed")}
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{
+		{Hook: failing, OnError: multihook.ErrorDisable, MaxErrors: 2, DisableFor: time.Minute},
+	}})
+	c.Assert(err, IsNil)
+	s.log.Hooks.Add(hook)
+
+	// Returns once the queue of the sink is empty
+	wait := func() {
+		for hook.Stats()[0].Queued != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.log.Info("one")
+	s.log.Info("two")
+	wait()
+	c.Assert(hook.Stats()[0].Disabled, Equals, true)
+
+	// The next record after DisableFor fails and disables the sink again
+	clock.Advance(time.Minute)
+	c.Assert(hook.Stats()[0].Disabled, Equals, false)
+	s.log.Info("three")
+	wait()
+	c.Assert(hook.Stats()[0].Disabled, Equals, true)
+	s.log.Info("dropped")
+
+	// A record which succeeds enables the sink
+	clock.Advance(time.Minute)
+	failing.mutex.Lock()
+	failing.err = nil
+	failing.mutex.Unlock()
+	s.log.Info("four")
+	wait()
+	s.log.Info("five")
+	c.Assert(hook.Close(), IsNil)
+
+	c.Assert(failing.Messages(), DeepEquals, []string{"one", "two", "three", "four", "five"})
+	stats := hook.Stats()[0]
+	c.Assert(stats.Disabled, Equals, false)
+	c.Assert(stats.Errors, Equals, int64(3))
+	c.Assert(stats.Sent, Equals, int64(2))
+}
+
+func (s *MultiHookTests) TestFireAfterClose(c *C) {
+	hook, err := multihook.New(multihook.Config{Sinks: []multihook.Sink{{Hook: &testHook{}}}})
+	c.Assert(err, IsNil)
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(hook.Fire(logrus.NewEntry(s.log)), ErrorMatches, "hook is closed")
+}
+
+func (s *MultiHookTests) TestConfig(c *C) {
+	_, err := multihook.New(multihook.Config{})
+	c.Assert(err, ErrorMatches, "at least one sink is required")
+	_, err = multihook.New(multihook.Config{Sinks: []multihook.Sink{{}}})
+	c.Assert(err, ErrorMatches, "sink 0 has no hook")
+}
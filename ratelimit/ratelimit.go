@@ -0,0 +1,230 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/internal/summary"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyFunc returns the key of the token bucket an entry is counted against
+type KeyFunc func(entry *logrus.Entry) string
+
+// RateLimiter limits the rate of the records forwarded to the wrapped hook.
+// Records are grouped by key, each key has a token bucket which allows a burst
+// of records then Rate records per second. The records a bucket suppresses are
+// counted, and a summary record is forwarded at the end of the window which
+// starts with the first suppressed record of the key.
+type RateLimiter struct {
+	hook    logrus.Hook
+	conf    Config
+	buckets map[string]*bucket
+
+	// Sync stuff
+	mutex     sync.Mutex
+	summaries *summary.Forwarder
+}
+
+type Config struct {
+	// Groups the records which share a token bucket, defaults to KeyByTemplate
+	Key KeyFunc
+	// Records per second allowed for each key, defaults to 10
+	Rate float64
+	// Records allowed in a burst for each key, defaults to 10
+	Burst int
+	// Probability a record of the level is forwarded, ie 0.1 forwards one in
+	// ten records. Levels missing from the map are always forwarded. Records
+	// dropped by sampling are not counted in the summaries.
+	Sampling map[logrus.Level]float64
+	// How long the records of a key are counted after the first suppressed
+	// record before a summary is forwarded, defaults to 10 seconds
+	Window time.Duration
+	// How often the summaries of the windows which ended are forwarded, defaults to 1 second
+	FlushInterval time.Duration
+}
+
+type bucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int
+	// When the first record of the window was suppressed
+	start time.Time
+	// Copy of the first record suppressed in the window
+	first *logrus.Entry
+}
+
+// New returns a hook which forwards the records of the hook allowed by the
+// rate limit. Panic and fatal records are never rate limited.
+func New(hook logrus.Hook, conf Config) *RateLimiter {
+	if conf.Key == nil {
+		conf.Key = KeyByTemplate
+	}
+	setter.SetDefault(&conf.Rate, 10.0)
+	setter.SetDefault(&conf.Burst, 10)
+	setter.SetDefault(&conf.Window, 10*time.Second)
+	setter.SetDefault(&conf.FlushInterval, time.Second)
+
+	rl := RateLimiter{
+		hook:    hook,
+		conf:    conf,
+		buckets: make(map[string]*bucket),
+	}
+	rl.summaries = summary.New("ratelimit", hook, conf.FlushInterval, &rl.mutex, rl.collect)
+	return &rl
+}
+
+// Levels returns the levels of the wrapped hook
+func (rl *RateLimiter) Levels() []logrus.Level {
+	return rl.hook.Levels()
+}
+
+func (rl *RateLimiter) Fire(entry *logrus.Entry) error {
+	if p, ok := rl.conf.Sampling[entry.Level]; ok && rand.Float64() >= p {
+		return nil
+	}
+
+	rl.mutex.Lock()
+	if rl.summaries.Closed() {
+		rl.mutex.Unlock()
+		return errors.New("hook is closed")
+	}
+	if entry.Level <= logrus.FatalLevel {
+		rl.mutex.Unlock()
+		return rl.hook.Fire(entry)
+	}
+	allowed, summary := rl.allow(entry)
+	rl.mutex.Unlock()
+
+	// The summary of an ended window goes before the next record of the key
+	if summary != nil {
+		if err := rl.hook.Fire(summary); err != nil {
+			return err
+		}
+	}
+	if !allowed {
+		return nil
+	}
+	return rl.hook.Fire(entry)
+}
+
+// Takes a token from the bucket of the entry, and returns the summary of the
+// window of the bucket if it ended. The caller must hold the mutex.
+func (rl *RateLimiter) allow(entry *logrus.Entry) (bool, *logrus.Entry) {
+	key := rl.conf.Key(entry)
+	now := clock.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rl.conf.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	rl.refill(b, now)
+
+	var summary *logrus.Entry
+	if b.suppressed != 0 && now.Sub(b.start) >= rl.conf.Window {
+		summary = b.summary(now)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, summary
+	}
+	if b.suppressed == 0 {
+		b.first = common.CopyEntry(entry)
+		b.start = now
+	}
+	b.suppressed++
+	return false, summary
+}
+
+// Returns the record forwarded for the suppressed records of the window and
+// starts a new window
+func (b *bucket) summary(now time.Time) *logrus.Entry {
+	summary := b.first
+	summary.Time = now
+	summary.Message = fmt.Sprintf("suppressed %d similar messages: %s", b.suppressed, summary.Message)
+	summary.Data["suppressed"] = b.suppressed
+	b.suppressed, b.first = 0, nil
+	return summary
+}
+
+func (rl *RateLimiter) refill(b *bucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * rl.conf.Rate
+	if b.tokens > float64(rl.conf.Burst) {
+		b.tokens = float64(rl.conf.Burst)
+	}
+	b.last = now
+}
+
+// Flush forwards a summary for every key with records suppressed since the
+// last summary, including the windows which have not ended yet
+func (rl *RateLimiter) Flush() error {
+	return rl.summaries.Flush()
+}
+
+// Returns the summaries of the windows which ended, or of every window
+func (rl *RateLimiter) collect(all bool) []*logrus.Entry {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	now := clock.Now()
+	var summaries []*logrus.Entry
+	for key, b := range rl.buckets {
+		rl.refill(b, now)
+		if b.suppressed == 0 {
+			// Forget the keys which have not been limited for a while
+			if b.tokens >= float64(rl.conf.Burst) {
+				delete(rl.buckets, key)
+			}
+			continue
+		}
+		if !all && now.Sub(b.start) < rl.conf.Window {
+			continue
+		}
+		summaries = append(summaries, b.summary(now))
+	}
+	return summaries
+}
+
+// Close forwards the pending summaries then closes the wrapped hook if it has
+// a `Close() error` method
+func (rl *RateLimiter) Close() error {
+	return rl.summaries.Close()
+}
+
+// Matches the words with a digit, ie numbers, ids and addresses
+var variableWords = regexp.MustCompile(`[^\s"'=:,;()\[\]{}]*[0-9][^\s"'=:,;()\[\]{}]*`)
+
+// KeyByTemplate groups the records by level and message, with the words
+// which contain digits masked so "user 42 not found" and "user 43 not found"
+// share a bucket
+func KeyByTemplate(entry *logrus.Entry) string {
+	return entry.Level.String() + "|" + variableWords.ReplaceAllString(entry.Message, "#")
+}
+
+// KeyByMessage groups the records by level and message
+func KeyByMessage(entry *logrus.Entry) string {
+	return entry.Level.String() + "|" + entry.Message
+}
+
+// KeyByCaller groups the records by the file and line they were logged from
+func KeyByCaller(entry *logrus.Entry) string {
+	if entry.Caller != nil {
+		return fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+	}
+	caller := common.GetLogrusCaller()
+	return fmt.Sprintf("%s:%d", caller.File, caller.LineNo)
+}
+
+// KeyByField groups the records by the value of the field
+func KeyByField(name string) KeyFunc {
+	return func(entry *logrus.Entry) string {
+		return fmt.Sprint(entry.Data[name])
+	}
+}
@@ -0,0 +1,321 @@
+package ratelimit_test
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mailgun/holster/v3/clock"
+	"github.com/mailgun/logrus-hooks/ratelimit"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type RateLimitSuite struct{}
+
+var _ = Suite(&RateLimitSuite{})
+
+type fakeHook struct {
+	mutex   sync.Mutex
+	entries []*logrus.Entry
+	closed  bool
+	// Records with the message `slow` wait until it is closed
+	slow chan struct{}
+}
+
+func (h *fakeHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fakeHook) Fire(entry *logrus.Entry) error {
+	if entry.Message == "slow" && h.slow != nil {
+		<-h.slow
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func (h *fakeHook) Close() error {
+	h.closed = true
+	return errors.New("kaboom")
+}
+
+func (h *fakeHook) Messages() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var result []string
+	for _, e := range h.entries {
+		result = append(result, e.Message)
+	}
+	return result
+}
+
+func (h *fakeHook) Last() *logrus.Entry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.entries[len(h.entries)-1]
+}
+
+func newLogger(hook logrus.Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Level = logrus.DebugLevel
+	logger.AddHook(hook)
+	return logger
+}
+
+func (s *RateLimitSuite) TestTokenBucket(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{Rate: 2, Burst: 3, Window: time.Hour})
+	defer rl.Close()
+	logger := newLogger(rl)
+
+	for i := 0; i < 5; i++ {
+		logger.WithField("attempt", i).Error("boom")
+	}
+	c.Assert(hook.Messages(), DeepEquals, []string{"boom", "boom", "boom"})
+
+	// The bucket refills at the rate
+	clock.Advance(time.Second)
+	for i := 0; i < 5; i++ {
+		logger.Error("boom")
+	}
+	c.Assert(len(hook.Messages()), Equals, 5)
+
+	c.Assert(rl.Flush(), IsNil)
+	summary := hook.Last()
+	c.Assert(summary.Message, Equals, "suppressed 5 similar messages: boom")
+	c.Assert(summary.Level, Equals, logrus.ErrorLevel)
+	c.Assert(summary.Time, Equals, clock.Now())
+	// The summary holds the fields and caller of the first suppressed record
+	c.Assert(summary.Data["suppressed"], Equals, 5)
+	c.Assert(summary.Data["attempt"], Equals, 3)
+	c.Assert(summary.Caller, NotNil)
+	c.Assert(summary.Caller.Function, Matches, ".*TestTokenBucket")
+
+	// Nothing was suppressed since the last summary
+	c.Assert(rl.Flush(), IsNil)
+	c.Assert(len(hook.Messages()), Equals, 6)
+}
+
+func (s *RateLimitSuite) TestKeys(c *C) {
+	for i, tc := range []struct {
+		key      ratelimit.KeyFunc
+		log      func(logger *logrus.Logger)
+		expected []string
+	}{
+		0: {
+			// Words with digits are masked in the template
+			key: ratelimit.KeyByTemplate,
+			log: func(logger *logrus.Logger) {
+				logger.Info("user 42 not found")
+				logger.Info("user 43 not found")
+				logger.Info("user ab12-cd34 not found")
+				logger.Info("cache miss")
+				logger.Warn("user 44 not found")
+			},
+			expected: []string{"user 42 not found", "cache miss", "user 44 not found"},
+		},
+		1: {
+			key: ratelimit.KeyByMessage,
+			log: func(logger *logrus.Logger) {
+				logger.Info("user 42 not found")
+				logger.Info("user 43 not found")
+				logger.Info("user 42 not found")
+			},
+			expected: []string{"user 42 not found", "user 43 not found"},
+		},
+		2: {
+			key: ratelimit.KeyByCaller,
+			log: func(logger *logrus.Logger) {
+				for i := 0; i < 2; i++ {
+					logger.Info("first")
+					logger.Info("second")
+				}
+			},
+			expected: []string{"first", "second"},
+		},
+		3: {
+			key: ratelimit.KeyByField("account_id"),
+			log: func(logger *logrus.Logger) {
+				logger.WithField("account_id", "acme").Info("first")
+				logger.WithField("account_id", "acme").Info("second")
+				logger.WithField("account_id", "hooli").Info("third")
+				logger.Info("fourth")
+				logger.Info("fifth")
+			},
+			expected: []string{"first", "third", "fourth"},
+		},
+	} {
+		c.Logf("Test case #%d", i)
+		func() {
+			defer clock.Freeze(clock.Now()).Unfreeze()
+			hook := &fakeHook{}
+			rl := ratelimit.New(hook, ratelimit.Config{Key: tc.key, Rate: 1, Burst: 1, Window: time.Hour})
+			defer rl.Close()
+
+			tc.log(newLogger(rl))
+			c.Assert(hook.Messages(), DeepEquals, tc.expected)
+		}()
+	}
+}
+
+func (s *RateLimitSuite) TestPanicNotLimited(c *C) {
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{Rate: 1, Burst: 1, Window: time.Hour})
+	defer rl.Close()
+
+	for i := 0; i < 3; i++ {
+		c.Assert(rl.Fire(&logrus.Entry{Level: logrus.PanicLevel, Message: "boom"}), IsNil)
+	}
+	c.Assert(hook.Messages(), DeepEquals, []string{"boom", "boom", "boom"})
+}
+
+func (s *RateLimitSuite) TestSampling(c *C) {
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{
+		Key: ratelimit.KeyByField("n"),
+		Sampling: map[logrus.Level]float64{
+			logrus.DebugLevel: 0,
+			logrus.InfoLevel:  0.5,
+			logrus.WarnLevel:  1,
+		},
+		Window: time.Hour,
+	})
+	defer rl.Close()
+
+	count := func(level logrus.Level) int {
+		hook.entries = nil
+		for i := 0; i < 1000; i++ {
+			c.Assert(rl.Fire(&logrus.Entry{Level: level, Data: logrus.Fields{"n": i}}), IsNil)
+		}
+		return len(hook.entries)
+	}
+	c.Assert(count(logrus.DebugLevel), Equals, 0)
+	c.Assert(count(logrus.WarnLevel), Equals, 1000)
+	c.Assert(count(logrus.ErrorLevel), Equals, 1000)
+	sampled := count(logrus.InfoLevel)
+	c.Assert(sampled > 400 && sampled < 600, Equals, true, Commentf("sampled %d", sampled))
+
+	// Sampled records are not counted as suppressed
+	hook.entries = nil
+	c.Assert(rl.Flush(), IsNil)
+	c.Assert(hook.entries, HasLen, 0)
+}
+
+func (s *RateLimitSuite) TestWindow(c *C) {
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{Rate: 1, Burst: 1, Window: 20 * time.Millisecond,
+		FlushInterval: 5 * time.Millisecond})
+	defer rl.Close()
+	logger := newLogger(rl)
+
+	logger.Error("boom")
+	logger.Error("boom")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hook.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(hook.Messages(), DeepEquals, []string{"boom", "suppressed 1 similar messages: boom"})
+}
+
+func (s *RateLimitSuite) TestWindowPerKey(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{
+		Key:           ratelimit.KeyByMessage,
+		Rate:          0.001,
+		Burst:         1,
+		Window:        10 * time.Second,
+		FlushInterval: time.Second,
+	})
+	defer rl.Close()
+	logger := newLogger(rl)
+
+	waitFor := func(count int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(hook.Messages()) < count && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	logger.Error("first")
+	logger.Error("first")
+	clock.Advance(5 * time.Second)
+	logger.Error("second")
+	logger.Error("second")
+
+	// The window of each key starts with its first suppressed record
+	clock.Advance(5 * time.Second)
+	waitFor(3)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(hook.Messages(), DeepEquals, []string{"first", "second",
+		"suppressed 1 similar messages: first"})
+
+	clock.Advance(5 * time.Second)
+	waitFor(4)
+	c.Assert(hook.Messages(), DeepEquals, []string{"first", "second",
+		"suppressed 1 similar messages: first", "suppressed 1 similar messages: second"})
+}
+
+func (s *RateLimitSuite) TestSummaryBeforeRecord(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{Rate: 1, Burst: 1, Window: time.Second, FlushInterval: time.Hour})
+	defer rl.Close()
+	logger := newLogger(rl)
+
+	logger.Error("boom")
+	logger.Error("boom")
+	clock.Advance(time.Second)
+	logger.Error("boom")
+	c.Assert(hook.Messages(), DeepEquals, []string{"boom", "suppressed 1 similar messages: boom", "boom"})
+}
+
+func (s *RateLimitSuite) TestFireNotSerialized(c *C) {
+	hook := &fakeHook{slow: make(chan struct{})}
+	rl := ratelimit.New(hook, ratelimit.Config{Window: time.Hour})
+	defer rl.Close()
+
+	done := make(chan struct{})
+	go func() {
+		_ = rl.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "slow", Data: logrus.Fields{}})
+		close(done)
+	}()
+
+	// A slow record does not hold up the records of other goroutines
+	c.Assert(rl.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "fast", Data: logrus.Fields{}}), IsNil)
+	c.Assert(hook.Messages(), DeepEquals, []string{"fast"})
+	close(hook.slow)
+	<-done
+}
+
+func (s *RateLimitSuite) TestClose(c *C) {
+	defer clock.Freeze(clock.Now()).Unfreeze()
+
+	hook := &fakeHook{}
+	rl := ratelimit.New(hook, ratelimit.Config{Rate: 1, Burst: 1, Window: time.Hour})
+	logger := newLogger(rl)
+
+	logger.Error("boom")
+	logger.Error("boom")
+
+	// The pending summaries are sent before the wrapped hook is closed
+	c.Assert(rl.Close(), ErrorMatches, "kaboom")
+	c.Assert(hook.closed, Equals, true)
+	c.Assert(hook.Messages(), DeepEquals, []string{"boom", "suppressed 1 similar messages: boom"})
+
+	c.Assert(rl.Fire(&logrus.Entry{Level: logrus.ErrorLevel}), ErrorMatches, "hook is closed")
+	c.Assert(rl.Close(), IsNil)
+}
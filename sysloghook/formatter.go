@@ -0,0 +1,216 @@
+package sysloghook
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mailgun/logrus-hooks/common"
+	"github.com/sirupsen/logrus"
+)
+
+// Facility is the syslog facility of the messages. The zero value is
+// FacilityDefault which selects FacilityUser, the values differ from the
+// syslog facility codes returned by Code().
+type Facility int
+
+const (
+	FacilityDefault Facility = iota
+	FacilityKern
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityLocal0 Facility = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Code returns the syslog facility code
+func (f Facility) Code() int {
+	if f == FacilityDefault {
+		return FacilityUser.Code()
+	}
+	return int(f) - 1
+}
+
+// The SD-IDs of the SD-ELEMENTs holding the context fields and the record
+// fields when none is given, 32473 is the private enterprise number reserved
+// for documentation
+const (
+	DefaultSDID       = "logrus@32473"
+	DefaultRecordSDID = "record@32473"
+)
+
+// The RFC 5424 timestamp layout, the RFC allows at most 6 fractional digits
+const timestampLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// Formatter formats entries as RFC 5424 syslog messages without framing. The
+// embedded JSONFormater extracts the LogRecord and holds its options.
+type Formatter struct {
+	common.JSONFormater
+
+	// The facility of the messages, defaults to FacilityUser
+	Facility Facility
+	// Overrides the APP-NAME and HOSTNAME of the record
+	AppName  string
+	HostName string
+	// The MSGID of the messages, defaults to the category of the record
+	MsgID string
+	// The SD-ID of the SD-ELEMENT holding the context fields, defaults to DefaultSDID
+	SDID string
+	// The context fields placed in the SD-ELEMENT, nested fields are
+	// selected by their dotted path, ie `http.method`
+	SDFields []string
+	// The SD-ID of the SD-ELEMENT holding the caller, the error and the trace
+	// of the record, defaults to DefaultRecordSDID
+	RecordSDID string
+}
+
+func NewFormatter() *Formatter {
+	return &Formatter{JSONFormater: *common.NewJSONFormater()}
+}
+
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	rec := f.Record(entry)
+
+	appName := rec.AppName
+	if f.AppName != "" {
+		appName = f.AppName
+	}
+	hostName := rec.HostName
+	if f.HostName != "" {
+		hostName = f.HostName
+	}
+	msgID := rec.Category
+	if f.MsgID != "" {
+		msgID = f.MsgID
+	}
+	procID := ""
+	if rec.PID != 0 {
+		procID = strconv.Itoa(rec.PID)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s ",
+		f.Facility.Code()*8+common.SyslogSeverity(entry.Level),
+		entry.Time.Format(timestampLayout),
+		headerField(hostName, 255),
+		headerField(appName, 48),
+		headerField(procID, 128),
+		headerField(msgID, 32))
+	f.appendStructuredData(&buf, rec)
+	if rec.Message != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(rec.Message)
+	}
+	return buf.Bytes(), nil
+}
+
+// Appends the SD-ELEMENT with the selected context fields of the record and
+// the SD-ELEMENT with the record fields, or the NILVALUE if both are empty
+func (f *Formatter) appendStructuredData(buf *bytes.Buffer, rec *common.LogRecord) {
+	context := common.FlattenMap(rec.Context, ".")
+
+	var params bytes.Buffer
+	for _, name := range f.SDFields {
+		if value, ok := context[name]; ok {
+			appendParam(&params, name, fmt.Sprint(value))
+		}
+	}
+	n := buf.Len()
+	appendElement(buf, f.SDID, DefaultSDID, params.Bytes())
+
+	params.Reset()
+	for _, p := range []struct {
+		name  string
+		value string
+	}{
+		{"filename", rec.FileName},
+		{"funcName", rec.FuncName},
+		{"lineno", strconv.Itoa(rec.LineNo)},
+		{"excType", rec.ExcType},
+		{"excValue", rec.ExcValue},
+		{"tid", rec.TID},
+		{"spanId", rec.SpanID},
+	} {
+		if p.value != "" && p.value != "0" {
+			appendParam(&params, p.name, p.value)
+		}
+	}
+	appendElement(buf, f.RecordSDID, DefaultRecordSDID, params.Bytes())
+
+	if buf.Len() == n {
+		buf.WriteByte('-')
+	}
+}
+
+func appendParam(buf *bytes.Buffer, name, value string) {
+	buf.WriteByte(' ')
+	buf.WriteString(sdName(name))
+	buf.WriteString(`="`)
+	buf.WriteString(sdValue(value))
+	buf.WriteByte('"')
+}
+
+// Appends the SD-ELEMENT if it has params
+func appendElement(buf *bytes.Buffer, sdID, defaultID string, params []byte) {
+	if len(params) == 0 {
+		return
+	}
+	if sdID == "" {
+		sdID = defaultID
+	}
+	buf.WriteByte('[')
+	buf.WriteString(sdName(sdID))
+	buf.Write(params)
+	buf.WriteByte(']')
+}
+
+// Returns the header field limited to printable ASCII and the maximum length
+// of the field, or the NILVALUE if the field is empty
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// Returns the SD-NAME with the characters it may not contain replaced
+func sdName(s string) string {
+	b := []byte(headerField(s, 32))
+	for i, c := range b {
+		if c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var sdValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdValue(s string) string {
+	return sdValueReplacer.Replace(s)
+}
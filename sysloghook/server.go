@@ -0,0 +1,259 @@
+package sysloghook
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a parsed RFC 5424 syslog message
+type Message struct {
+	Facility  Facility
+	Severity  int
+	Version   int
+	Timestamp time.Time
+	HostName  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	// The params of each SD-ELEMENT by SD-ID
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// Test Syslog Server, accepts messages over `udp`, `tcp`, `unixgram` or `unix`
+type Server struct {
+	network  string
+	conn     net.PacketConn
+	listener net.Listener
+	done     chan struct{}
+	resp     chan []byte
+}
+
+func NewServer(network, address string) (*Server, error) {
+	s := Server{
+		network: network,
+		done:    make(chan struct{}),
+		resp:    make(chan []byte),
+	}
+
+	var err error
+	switch network {
+	case "udp", "unixgram":
+		if s.conn, err = net.ListenPacket(network, address); err != nil {
+			return nil, errors.Wrapf(err, "net.ListenPacket(%s, %s)", network, address)
+		}
+		go s.readPackets()
+	case "tcp", "unix":
+		if s.listener, err = net.Listen(network, address); err != nil {
+			return nil, errors.Wrapf(err, "net.Listen(%s, %s)", network, address)
+		}
+		go s.accept()
+	default:
+		return nil, fmt.Errorf("unsupported network '%s'", network)
+	}
+	return &s, nil
+}
+
+func (s *Server) readPackets() {
+	buf := make([]byte, 65536)
+	for {
+		length, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if !s.send(append([]byte(nil), buf[:length]...)) {
+			return
+		}
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.readFrames(conn)
+	}
+}
+
+// Reads octet-counted frames from the connection
+func (s *Server) readFrames(conn net.Conn) {
+	defer conn.Close()
+	go func() {
+		<-s.done
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		length, err := strconv.Atoi(prefix[:len(prefix)-1])
+		if err != nil {
+			return
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		if !s.send(buf) {
+			return
+		}
+	}
+}
+
+func (s *Server) send(buf []byte) bool {
+	select {
+	case s.resp <- buf:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// Returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.conn != nil {
+		return s.conn.LocalAddr().String()
+	}
+	return s.listener.Addr().String()
+}
+
+// Returns the next message received by the server
+func (s *Server) GetMessage() (*Message, error) {
+	data := <-s.resp
+	fmt.Printf("%s\n", string(data))
+	return ParseMessage(data)
+}
+
+func (s *Server) Close() {
+	close(s.done)
+	if s.conn != nil {
+		s.conn.Close()
+	} else {
+		s.listener.Close()
+	}
+}
+
+// ParseMessage parses an RFC 5424 message without framing
+func ParseMessage(buf []byte) (*Message, error) {
+	var msg Message
+
+	if len(buf) == 0 || buf[0] != '<' {
+		return nil, errors.New("missing PRI")
+	}
+	end := bytes.IndexByte(buf, '>')
+	if end < 0 {
+		return nil, errors.New("missing PRI")
+	}
+	pri, err := strconv.Atoi(string(buf[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("invalid PRI '%s'", buf[1:end])
+	}
+	msg.Facility, msg.Severity = Facility(pri/8+1), pri%8
+	buf = buf[end+1:]
+
+	fields := make([]string, 6)
+	for i := range fields {
+		idx := bytes.IndexByte(buf, ' ')
+		if idx < 0 {
+			return nil, errors.New("truncated header")
+		}
+		fields[i], buf = string(buf[:idx]), buf[idx+1:]
+	}
+	if msg.Version, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, fmt.Errorf("invalid VERSION '%s'", fields[0])
+	}
+	if fields[1] != "-" {
+		if msg.Timestamp, err = time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid TIMESTAMP '%s'", fields[1])
+		}
+	}
+	msg.HostName = nilValue(fields[2])
+	msg.AppName = nilValue(fields[3])
+	msg.ProcID = nilValue(fields[4])
+	msg.MsgID = nilValue(fields[5])
+
+	if msg.StructuredData, buf, err = parseStructuredData(buf); err != nil {
+		return nil, err
+	}
+	if len(buf) != 0 {
+		if buf[0] != ' ' {
+			return nil, errors.New("missing space before MSG")
+		}
+		msg.Message = string(bytes.TrimPrefix(buf[1:], []byte("\xEF\xBB\xBF")))
+	}
+	return &msg, nil
+}
+
+// Parses the STRUCTURED-DATA at the start of the buffer, returns the
+// remainder of the buffer
+func parseStructuredData(buf []byte) (map[string]map[string]string, []byte, error) {
+	if len(buf) != 0 && buf[0] == '-' {
+		return nil, buf[1:], nil
+	}
+
+	result := make(map[string]map[string]string)
+	for len(buf) != 0 && buf[0] == '[' {
+		end := bytes.IndexAny(buf, " ]")
+		if end < 0 {
+			return nil, nil, errors.New("truncated SD-ELEMENT")
+		}
+		params := make(map[string]string)
+		result[string(buf[1:end])] = params
+		buf = buf[end:]
+
+		for len(buf) != 0 && buf[0] == ' ' {
+			eq := bytes.IndexByte(buf, '=')
+			if eq < 0 || eq+1 >= len(buf) || buf[eq+1] != '"' {
+				return nil, nil, errors.New("invalid SD-PARAM")
+			}
+			name := string(buf[1:eq])
+			buf = buf[eq+2:]
+
+			var value []byte
+			closed := false
+			for i := 0; i < len(buf); i++ {
+				if buf[i] == '\\' && i+1 < len(buf) && bytes.IndexByte([]byte(`"\]`), buf[i+1]) >= 0 {
+					i++
+					value = append(value, buf[i])
+					continue
+				}
+				if buf[i] == '"' {
+					buf, closed = buf[i+1:], true
+					break
+				}
+				value = append(value, buf[i])
+			}
+			if !closed {
+				return nil, nil, errors.New("unterminated PARAM-VALUE")
+			}
+			params[name] = string(value)
+		}
+		if len(buf) == 0 || buf[0] != ']' {
+			return nil, nil, errors.New("unterminated SD-ELEMENT")
+		}
+		buf = buf[1:]
+	}
+	if len(result) == 0 {
+		return nil, nil, errors.New("missing STRUCTURED-DATA")
+	}
+	return result, buf, nil
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package sysloghook
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type SyslogHook struct {
+	formatter logrus.Formatter
+	conf      Config
+	conn      net.Conn
+	mutex     sync.Mutex
+	closed    bool
+	debug     bool
+}
+
+type Config struct {
+	// One of `udp`, `tcp`, `unixgram` or `unix`, defaults to `udp`. Messages
+	// sent over `tcp` or `unix` are framed with octet-counting (RFC 6587)
+	Network string
+	// The `host:port` or the socket path of the syslog server, defaults to `localhost:514`
+	Address string
+	// Timeout of connects and writes, defaults to 5 seconds
+	Timeout time.Duration
+
+	// The facility of the messages, defaults to FacilityUser
+	Facility Facility
+	// Overrides the APP-NAME and HOSTNAME of the messages
+	AppName  string
+	HostName string
+	// The MSGID of the messages, defaults to the category of the record
+	MsgID string
+	// The SD-ID of the SD-ELEMENT holding the context fields, defaults to DefaultSDID
+	SDID string
+	// The context fields placed in the SD-ELEMENT
+	SDFields []string
+	// The SD-ID of the SD-ELEMENT holding the caller, the error and the trace
+	// of the record, defaults to DefaultRecordSDID
+	RecordSDID string
+}
+
+func New(conf Config) (*SyslogHook, error) {
+	setter.SetDefault(&conf.Network, "udp")
+	setter.SetDefault(&conf.Address, "localhost:514")
+	setter.SetDefault(&conf.Timeout, 5*time.Second)
+
+	switch conf.Network {
+	case "udp", "tcp", "unixgram", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported network '%s'", conf.Network)
+	}
+
+	f := NewFormatter()
+	f.Facility = conf.Facility
+	f.AppName = conf.AppName
+	f.HostName = conf.HostName
+	f.MsgID = conf.MsgID
+	f.SDID = conf.SDID
+	f.SDFields = conf.SDFields
+	f.RecordSDID = conf.RecordSDID
+
+	h := SyslogHook{
+		formatter: f,
+		conf:      conf,
+	}
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	buf, err := h.formatter.Format(entry)
+	if err != nil {
+		return errors.Wrap(err, "while formatting entry")
+	}
+
+	if h.debug {
+		fmt.Printf("%s\n", string(buf))
+	}
+
+	if h.isStream() {
+		buf = append([]byte(strconv.Itoa(len(buf))+" "), buf...)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+
+	err = h.write(buf)
+	if err != nil && h.isStream() {
+		// The server might have closed the connection, reconnect and retry once
+		if err = h.connect(); err == nil {
+			err = h.write(buf)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "SyslogHook.Fire()")
+	}
+	return nil
+}
+
+func (h *SyslogHook) isStream() bool {
+	return h.conf.Network == "tcp" || h.conf.Network == "unix"
+}
+
+func (h *SyslogHook) connect() error {
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+	conn, err := net.DialTimeout(h.conf.Network, h.conf.Address, h.conf.Timeout)
+	if err != nil {
+		return errors.Wrapf(err, "net.Dial(%s, %s)", h.conf.Network, h.conf.Address)
+	}
+	h.conn = conn
+	return nil
+}
+
+func (h *SyslogHook) write(buf []byte) error {
+	if h.conn == nil {
+		return errors.New("not connected")
+	}
+	if err := h.conn.SetWriteDeadline(time.Now().Add(h.conf.Timeout)); err != nil {
+		return errors.Wrap(err, "SetWriteDeadline() error")
+	}
+	length, err := h.conn.Write(buf)
+	if err != nil {
+		return errors.Wrap(err, "Write() error")
+	}
+	if length != len(buf) {
+		return fmt.Errorf("Write() only wrote %d of %d bytes", length, len(buf))
+	}
+	return nil
+}
+
+// Levels returns the available logging levels.
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *SyslogHook) SetDebug(set bool) {
+	h.debug = set
+}
+
+// Close the connection to the syslog server, Fire returns an error afterwards
+func (h *SyslogHook) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
@@ -0,0 +1,240 @@
+package sysloghook_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mailgun/logrus-hooks/sysloghook"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestSyslogHook(t *testing.T) { TestingT(t) }
+
+type SyslogHookTests struct {
+	dir string
+}
+
+var _ = Suite(&SyslogHookTests{})
+
+func (s *SyslogHookTests) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// Returns a logger sending to a new server listening on the network
+func (s *SyslogHookTests) newLogger(c *C, network string, conf sysloghook.Config) (*logrus.Logger, *sysloghook.Server, *sysloghook.SyslogHook) {
+	address := "127.0.0.1:0"
+	if network == "unix" || network == "unixgram" {
+		address = filepath.Join(s.dir, network+".sock")
+	}
+	server, err := sysloghook.NewServer(network, address)
+	c.Assert(err, IsNil)
+
+	conf.Network = network
+	conf.Address = server.Addr()
+	hook, err := sysloghook.New(conf)
+	c.Assert(err, IsNil)
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(hook)
+	return log, server, hook
+}
+
+func (s *SyslogHookTests) TestNetworks(c *C) {
+	for _, network := range []string{"udp", "tcp", "unixgram", "unix"} {
+		c.Logf("Network %s", network)
+		log, server, hook := s.newLogger(c, network, sysloghook.Config{})
+
+		log.Warn("this is a test")
+		log.Info("this is another test")
+
+		msg, err := server.GetMessage()
+		c.Assert(err, IsNil)
+		c.Assert(msg.Message, Equals, "this is a test")
+		c.Assert(msg.Severity, Equals, 4)
+
+		msg, err = server.GetMessage()
+		c.Assert(err, IsNil)
+		c.Assert(msg.Message, Equals, "this is another test")
+		c.Assert(msg.Severity, Equals, 6)
+
+		c.Assert(hook.Close(), IsNil)
+		server.Close()
+	}
+}
+
+func (s *SyslogHookTests) TestHeader(c *C) {
+	log, server, hook := s.newLogger(c, "udp", sysloghook.Config{
+		Facility: sysloghook.FacilityLocal3,
+		AppName:  "my app",
+		HostName: "host1",
+		MsgID:    "ID47",
+	})
+	defer server.Close()
+	defer hook.Close()
+
+	before := time.Now()
+	log.Error("this is a test")
+
+	msg, err := server.GetMessage()
+	c.Assert(err, IsNil)
+	c.Assert(msg.Facility, Equals, sysloghook.FacilityLocal3)
+	c.Assert(msg.Severity, Equals, 3)
+	c.Assert(msg.Version, Equals, 1)
+	c.Assert(msg.HostName, Equals, "host1")
+	c.Assert(msg.AppName, Equals, "my_app")
+	c.Assert(msg.ProcID, Equals, strconv.Itoa(os.Getpid()))
+	c.Assert(msg.MsgID, Equals, "ID47")
+	c.Assert(msg.StructuredData[sysloghook.DefaultRecordSDID]["funcName"], Equals, "sysloghook_test.(*SyslogHookTests).TestHeader")
+	c.Assert(msg.Timestamp.Before(before.Add(-time.Microsecond)), Equals, false)
+}
+
+func (s *SyslogHookTests) TestFacility(c *C) {
+	for i, tc := range []struct {
+		facility sysloghook.Facility
+		expected sysloghook.Facility
+		code     int
+	}{
+		0: {facility: sysloghook.FacilityDefault, expected: sysloghook.FacilityUser, code: 1},
+		1: {facility: sysloghook.FacilityKern, expected: sysloghook.FacilityKern, code: 0},
+		2: {facility: sysloghook.FacilityLocal7, expected: sysloghook.FacilityLocal7, code: 23},
+	} {
+		fmt.Printf("Test case #%d\n", i)
+
+		log, server, hook := s.newLogger(c, "udp", sysloghook.Config{Facility: tc.facility})
+		log.Info("this is a test")
+
+		msg, err := server.GetMessage()
+		c.Assert(err, IsNil)
+		c.Assert(msg.Facility, Equals, tc.expected)
+		c.Assert(msg.Facility.Code(), Equals, tc.code)
+		c.Assert(hook.Close(), IsNil)
+		server.Close()
+	}
+}
+
+func (s *SyslogHookTests) TestFireAfterClose(c *C) {
+	_, server, hook := s.newLogger(c, "tcp", sysloghook.Config{})
+	defer server.Close()
+	c.Assert(hook.Close(), IsNil)
+
+	// The hook does not reconnect once closed
+	err := hook.Fire(logrus.NewEntry(logrus.New()))
+	c.Assert(err, ErrorMatches, "hook is closed")
+}
+
+func (s *SyslogHookTests) TestStructuredData(c *C) {
+	log, server, hook := s.newLogger(c, "tcp", sysloghook.Config{
+		SDFields: []string{"domain.id", "quote", "missing"},
+	})
+	defer server.Close()
+	defer hook.Close()
+
+	log.WithFields(logrus.Fields{
+		"domain.id": 282,
+		"quote":     `a "quoted" [value] \ `,
+		"other":     "not included",
+	}).Info("this is a test")
+
+	msg, err := server.GetMessage()
+	c.Assert(err, IsNil)
+	c.Assert(msg.MsgID, Equals, "logrus")
+	c.Assert(msg.StructuredData[sysloghook.DefaultSDID], DeepEquals, map[string]string{
+		"domain.id": "282",
+		"quote":     `a "quoted" [value] \ `,
+	})
+	c.Assert(msg.Message, Equals, "this is a test")
+}
+
+func (s *SyslogHookTests) TestRecordFields(c *C) {
+	log, server, hook := s.newLogger(c, "udp", sysloghook.Config{RecordSDID: "rec@1"})
+	defer server.Close()
+	defer hook.Close()
+
+	log.WithError(errors.New("boom")).WithField("tid", "trace-1").Error("this is a test")
+
+	msg, err := server.GetMessage()
+	c.Assert(err, IsNil)
+	sd := msg.StructuredData["rec@1"]
+	c.Assert(sd["excType"], Equals, "*errors.fundamental")
+	c.Assert(sd["excValue"], Equals, "boom")
+	c.Assert(sd["tid"], Equals, "trace-1")
+	c.Assert(sd["funcName"], Equals, "sysloghook_test.(*SyslogHookTests).TestRecordFields")
+	c.Assert(sd["filename"], Matches, ".*/sysloghook_test.go")
+	c.Assert(sd["lineno"], Matches, "[0-9]+")
+	_, ok := sd["spanId"]
+	c.Assert(ok, Equals, false)
+	c.Assert(msg.Message, Equals, "this is a test")
+}
+
+func (s *SyslogHookTests) TestReconnect(c *C) {
+	log, server, hook := s.newLogger(c, "tcp", sysloghook.Config{})
+	defer hook.Close()
+
+	log.Info("first")
+	_, err := server.GetMessage()
+	c.Assert(err, IsNil)
+
+	// Restart the server on the same address
+	address := server.Addr()
+	server.Close()
+	server, err = sysloghook.NewServer("tcp", address)
+	c.Assert(err, IsNil)
+	defer server.Close()
+
+	// The first write after the close might succeed, keep logging until the
+	// hook notices and reconnects
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				log.Info("second")
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}()
+	msg, err := server.GetMessage()
+	c.Assert(err, IsNil)
+	c.Assert(msg.Message, Equals, "second")
+}
+
+func (s *SyslogHookTests) TestUnsupportedNetwork(c *C) {
+	_, err := sysloghook.New(sysloghook.Config{Network: "http"})
+	c.Assert(err, ErrorMatches, "unsupported network 'http'")
+}
+
+func (s *SyslogHookTests) TestParseMessage(c *C) {
+	for i, tt := range []struct {
+		msg string
+		err string
+	}{
+		{msg: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed`},
+		{msg: `<165>1 2003-10-11T22:14:15.003Z host app 1 ID47 [exampleSDID@32473 iut="3" eventSource="App"][b@1 x="\]"] msg`},
+		{msg: `<165>1 - - - - - -`},
+		{msg: `34>1 - - - - - -`, err: "missing PRI"},
+		{msg: `<192>1 - - - - - -`, err: "invalid PRI '192'"},
+		{msg: `<34>1 - - -`, err: "truncated header"},
+		{msg: `<34>1 - - - - - [a b]`, err: "invalid SD-PARAM"},
+		{msg: `<34>1 - - - - - [a b="c]`, err: "unterminated PARAM-VALUE"},
+		{msg: `<34>1 - - - - - msg`, err: "missing STRUCTURED-DATA"},
+	} {
+		c.Logf("Test case #%d", i)
+		_, err := sysloghook.ParseMessage([]byte(tt.msg))
+		if tt.err != "" {
+			c.Assert(err, ErrorMatches, tt.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+	}
+}
@@ -1,13 +1,18 @@
 package udploghook
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/mailgun/logrus-hooks/common"
 	"github.com/pkg/errors"
 )
 
@@ -41,7 +46,7 @@ func NewServer(host string, port int) (*Server, error) {
 		for {
 			length, _, _ := udp.conn.ReadFromUDP(buf)
 			select {
-			case udp.resp <- buf[0:length]:
+			case udp.resp <- append([]byte(nil), buf[0:length]...):
 			case <-udp.done:
 				return
 
@@ -63,17 +68,140 @@ func (udp *Server) Port() int {
 }
 
 func (udp *Server) GetRequest() map[string]interface{} {
+	return toRequest(<-udp.resp)
+}
+
+// Returns the next record received by the server parsed by common.ParseRecordStrict()
+func (udp *Server) GetRecord() (*common.LogRecord, error) {
+	return toRecord(<-udp.resp)
+}
+
+func (udp *Server) Close() {
+	close(udp.done)
+	udp.conn.Close()
+}
+
+// Test Stream Server, accepts records from StreamHook over `tcp` or `unix`
+type StreamServer struct {
+	listener net.Listener
+	framing  Framing
+	done     chan struct{}
+	resp     chan []byte
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewStreamServer listens on the address for records in the framing, if
+// tlsConf is provided connections must use TLS
+func NewStreamServer(network, address string, framing Framing, tlsConf *tls.Config) (*StreamServer, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "net.Listen(%s, %s)", network, address)
+	}
+	if tlsConf != nil {
+		listener = tls.NewListener(listener, tlsConf)
+	}
+
+	s := StreamServer{
+		listener: listener,
+		framing:  framing,
+		done:     make(chan struct{}),
+		resp:     make(chan []byte),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.conns[conn] = struct{}{}
+			s.mutex.Unlock()
+			go s.read(conn)
+		}
+	}()
+	return &s, nil
+}
+
+func (s *StreamServer) read(conn net.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		var buf []byte
+		var err error
+		if s.framing == FramingLengthPrefix {
+			var length uint32
+			if err = binary.Read(r, binary.BigEndian, &length); err == nil {
+				buf = make([]byte, length)
+				_, err = io.ReadFull(r, buf)
+			}
+		} else {
+			buf, err = r.ReadBytes('\n')
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case s.resp <- buf:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Returns the address the server is listening on
+func (s *StreamServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Closes the connections the server has accepted, the server keeps listening
+func (s *StreamServer) CloseConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Returns the next record received by the server as sent, including the prefix
+func (s *StreamServer) GetData() []byte {
+	return <-s.resp
+}
+
+func (s *StreamServer) GetRequest() map[string]interface{} {
+	return toRequest(<-s.resp)
+}
+
+// Returns the next record received by the server parsed by common.ParseRecordStrict()
+func (s *StreamServer) GetRecord() (*common.LogRecord, error) {
+	return toRecord(<-s.resp)
+}
+
+func (s *StreamServer) Close() {
+	close(s.done)
+	s.listener.Close()
+	s.CloseConns()
+}
+
+func toRequest(data []byte) map[string]interface{} {
 	var result map[string]interface{}
-	data := <-udp.resp
 	fmt.Printf("%s\n", string(data))
-	parts := bytes.SplitN(data, []byte(":"), 2)
-	if err := json.Unmarshal(parts[1], &result); err != nil {
+	_, body := common.SplitPrefix(data)
+	if err := json.Unmarshal(body, &result); err != nil {
 		fmt.Printf("json.Unmarshal() error: %s\n", err)
 	}
 	return result
 }
 
-func (udp *Server) Close() {
-	close(udp.done)
-	udp.conn.Close()
+func toRecord(data []byte) (*common.LogRecord, error) {
+	fmt.Printf("%s\n", string(data))
+	return common.ParseRecordStrict(data)
 }
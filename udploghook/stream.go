@@ -0,0 +1,267 @@
+package udploghook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailgun/holster/v3/setter"
+	"github.com/mailgun/logrus-hooks/common/encoding"
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Framing separates the records sent over a stream
+type Framing int
+
+const (
+	// Each record is terminated by a newline
+	FramingNewline Framing = iota
+	// Each record is preceded by its length as a 4 byte big endian integer
+	FramingLengthPrefix
+)
+
+// StreamHook sends records to udplog over a TCP or unix socket stream. Records
+// are buffered in memory while the hook reconnects.
+type StreamHook struct {
+	// Accessed atomically, first for 64 bit alignment on 32 bit platforms
+	overflows int64
+
+	formatter logrus.Formatter
+	queue     chan []byte
+	conf      StreamConfig
+	conn      net.Conn
+	debug     bool
+
+	// Sync stuff
+	wg         sync.WaitGroup
+	once       sync.Once
+	abort      chan struct{}
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+type StreamConfig struct {
+	// Either `tcp` or `unix`, defaults to `tcp`
+	Network string
+	// The `host:port` or the socket path of udplog
+	Address string
+	// Defaults to FramingNewline
+	Framing Framing
+	// If provided, the connection is made with TLS
+	TLS *tls.Config
+	// Formats each record, defaults to the formatter of the Encoding
+	Formatter logrus.Formatter
+	// If no Formatter is provided, the formatter for this encoding is used,
+	// defaults to encoding.JSON. Binary encodings require FramingLengthPrefix
+	Encoding encoding.Encoding
+
+	// Number of records buffered before new records are dropped, defaults to 1000
+	BufferSize int
+	// Wait before the first reconnect, doubled on each attempt, defaults to 100ms
+	ReconnectBackoff time.Duration
+	// Maximum wait between reconnects, defaults to 10 seconds
+	MaxReconnectBackoff time.Duration
+	// Timeout of connects and writes, defaults to 5 seconds
+	Timeout time.Duration
+	// How long Close() waits for buffered records to be sent, defaults to 5 seconds
+	CloseTimeout time.Duration
+}
+
+func NewStream(conf StreamConfig) (*StreamHook, error) {
+	if conf.Address == "" {
+		return nil, errors.New("Address is required")
+	}
+	setter.SetDefault(&conf.Network, "tcp")
+	setter.SetDefault(&conf.BufferSize, 1000)
+	setter.SetDefault(&conf.ReconnectBackoff, 100*time.Millisecond)
+	setter.SetDefault(&conf.MaxReconnectBackoff, 10*time.Second)
+	setter.SetDefault(&conf.Timeout, 5*time.Second)
+	setter.SetDefault(&conf.CloseTimeout, 5*time.Second)
+
+	if conf.Network != "tcp" && conf.Network != "unix" {
+		return nil, fmt.Errorf("unsupported network '%s'", conf.Network)
+	}
+
+	// If no formatter defined, use the formatter for the encoding
+	if conf.Formatter == nil {
+		var err error
+		if conf.Formatter, err = encoding.NewFormatter(conf.Encoding); err != nil {
+			return nil, errors.Wrap(err, "stream formatter error")
+		}
+	}
+	if isBinary(conf.Encoding) && conf.Framing != FramingLengthPrefix {
+		return nil, fmt.Errorf("encoding '%s' requires FramingLengthPrefix", conf.Encoding)
+	}
+
+	h := StreamHook{
+		formatter: conf.Formatter,
+		queue:     make(chan []byte, conf.BufferSize),
+		conf:      conf,
+		abort:     make(chan struct{}),
+	}
+
+	// Fail early if the address is unreachable, later failures are retried
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for buf := range h.queue {
+			if !h.send(buf) {
+				_, _ = fmt.Fprintf(os.Stderr, "[udploghook] close timeout, dropped %d records\n", 1+len(h.queue))
+				return
+			}
+		}
+		if h.conn != nil {
+			h.conn.Close()
+		}
+	}()
+	return &h, nil
+}
+
+func (h *StreamHook) Fire(entry *logrus.Entry) error {
+	var w jwriter.Writer
+	w.RawString("logrus:")
+	w.Raw(h.formatter.Format(entry))
+
+	if w.Error != nil {
+		return errors.Wrap(w.Error, "while formatting entry")
+	}
+	buf := w.Buffer.BuildBytes()
+	// A trailing newline of a binary record is part of the record
+	if !isBinary(h.conf.Encoding) {
+		buf = bytes.TrimRight(buf, "\n")
+	}
+	buf = h.frame(buf)
+
+	if h.debug {
+		fmt.Printf("%s\n", string(buf))
+	}
+
+	h.closeMutex.RLock()
+	defer h.closeMutex.RUnlock()
+	if h.closed {
+		return errors.New("hook is closed")
+	}
+	select {
+	case h.queue <- buf:
+	default:
+		// If the queue is full, then we better drop a log record than
+		// block program execution.
+		atomic.AddInt64(&h.overflows, 1)
+		_, _ = fmt.Fprintf(os.Stderr, "[udploghook] buffer overflow: %s\n", string(buf))
+	}
+	return nil
+}
+
+// Returns true if records in the encoding are not text
+func isBinary(enc encoding.Encoding) bool {
+	return enc != "" && enc != encoding.JSON
+}
+
+func (h *StreamHook) frame(buf []byte) []byte {
+	if h.conf.Framing == FramingLengthPrefix {
+		result := make([]byte, 4, len(buf)+4)
+		binary.BigEndian.PutUint32(result, uint32(len(buf)))
+		return append(result, buf...)
+	}
+	return append(buf, '\n')
+}
+
+// Writes the framed record, reconnecting with backoff until it is written.
+// Returns false if Close() timed out while reconnecting.
+func (h *StreamHook) send(buf []byte) bool {
+	backoff := h.conf.ReconnectBackoff
+	for {
+		if h.conn != nil {
+			err := h.write(buf)
+			if err == nil {
+				return true
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "[udploghook] write error '%s', reconnecting\n", err)
+			h.conn.Close()
+			h.conn = nil
+		}
+
+		if err := h.connect(); err == nil {
+			backoff = h.conf.ReconnectBackoff
+			continue
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-h.abort:
+			return false
+		}
+		if backoff *= 2; backoff > h.conf.MaxReconnectBackoff {
+			backoff = h.conf.MaxReconnectBackoff
+		}
+	}
+}
+
+func (h *StreamHook) connect() error {
+	dialer := &net.Dialer{Timeout: h.conf.Timeout}
+	var conn net.Conn
+	var err error
+	if h.conf.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, h.conf.Network, h.conf.Address, h.conf.TLS)
+	} else {
+		conn, err = dialer.Dial(h.conf.Network, h.conf.Address)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "net.Dial(%s, %s)", h.conf.Network, h.conf.Address)
+	}
+	h.conn = conn
+	return nil
+}
+
+func (h *StreamHook) write(buf []byte) error {
+	if err := h.conn.SetWriteDeadline(time.Now().Add(h.conf.Timeout)); err != nil {
+		return errors.Wrap(err, "SetWriteDeadline() error")
+	}
+	if _, err := h.conn.Write(buf); err != nil {
+		return errors.Wrap(err, "Write() error")
+	}
+	return nil
+}
+
+// Levels returns the available logging levels.
+func (h *StreamHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *StreamHook) SetDebug(set bool) {
+	h.debug = set
+}
+
+// Overflows returns the number of records dropped because the buffer was full
+func (h *StreamHook) Overflows() int64 {
+	return atomic.LoadInt64(&h.overflows)
+}
+
+// Close the hook and flush any buffered records. If the records can not be
+// sent within the CloseTimeout they are dropped. Fire returns an error
+// afterwards.
+func (h *StreamHook) Close() error {
+	h.once.Do(func() {
+		h.closeMutex.Lock()
+		h.closed = true
+		close(h.queue)
+		h.closeMutex.Unlock()
+
+		timer := time.AfterFunc(h.conf.CloseTimeout, func() { close(h.abort) })
+		h.wg.Wait()
+		timer.Stop()
+	})
+	return nil
+}
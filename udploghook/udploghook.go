@@ -98,3 +98,9 @@ func (h *UDPHook) Levels() []logrus.Level {
 func (h *UDPHook) SetDebug(set bool) {
 	h.debug = set
 }
+
+// SetFormatter replaces the formatter of the records, which defaults to
+// common.DefaultFormatter
+func (h *UDPHook) SetFormatter(formatter logrus.Formatter) {
+	h.formatter = formatter
+}
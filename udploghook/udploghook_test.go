@@ -2,13 +2,25 @@ package udploghook_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mailgun/holster/v3/errors"
 	"github.com/mailgun/logrus-hooks/common"
+	"github.com/mailgun/logrus-hooks/common/encoding"
 	"github.com/mailgun/logrus-hooks/udploghook"
 	"github.com/sirupsen/logrus"
 	. "gopkg.in/check.v1"
@@ -152,13 +164,13 @@ func (s *UDPLogHookTests) TestFromErr(c *C) {
 	c.Assert(strings.Contains(req["filename"].(string),
 		"udploghook/udploghook_test.go"),
 		Equals, true, Commentf(req["filename"].(string)))
-	c.Assert(req["lineno"], Equals, float64(147))
+	c.Assert(req["lineno"], Equals, float64(159))
 	c.Assert(req["funcName"].(string), Equals,
 		"udploghook_test.(*UDPLogHookTests).TestFromErr")
 	c.Assert(req["excType"], Equals, "*errors.fundamental")
 	c.Assert(req["excValue"], Equals, "bar: foo")
 	c.Assert(strings.Contains(req["excText"].(string), "(*UDPLogHookTests).TestFromErr"), Equals, true)
-	c.Assert(strings.Contains(req["excText"].(string), "udploghook/udploghook_test.go:147"), Equals, true)
+	c.Assert(strings.Contains(req["excText"].(string), "udploghook/udploghook_test.go:158"), Equals, true)
 }
 
 func (s *UDPLogHookTests) TestTIDAsString(c *C) {
@@ -178,3 +190,227 @@ func (s *UDPLogHookTests) TestTIDAsOther(c *C) {
 	context := req["context"].(map[string]interface{})
 	c.Assert(context["tid"], Equals, float64(10))
 }
+
+func (s *UDPLogHookTests) TestCorrelationFields(c *C) {
+	ctx := common.ContextWithCorrelation(context.Background(), common.Correlation{
+		TraceID:  "0af7651916cd43dd8448eb211c80319c",
+		TenantID: "acme",
+	})
+	s.log.WithContext(ctx).WithFields(logrus.Fields{
+		"request_id": "req-1",
+		"user_id":    "42",
+	}).Info("Info Called")
+
+	rec, err := s.server.GetRecord()
+	c.Assert(err, IsNil)
+	c.Assert(rec.TID, Equals, "0af7651916cd43dd8448eb211c80319c")
+	c.Assert(rec.TenantID, Equals, "acme")
+	// The fields stay in the context without FieldOptions.CorrelationFields
+	c.Assert(rec.RequestID, Equals, "")
+	c.Assert(rec.Context, DeepEquals, map[string]interface{}{"request_id": "req-1", "user_id": "42"})
+}
+
+func (s *UDPLogHookTests) TestUDPHookRecord(c *C) {
+	s.log.WithFields(logrus.Fields{"domain": "example.com"}).Warn("Warn Called")
+
+	rec, err := s.server.GetRecord()
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "Warn Called")
+	c.Assert(rec.LogLevel, Equals, "WARNING")
+	c.Assert(rec.Category, Equals, "logrus")
+	c.Assert(rec.FuncName, Equals, "udploghook_test.(*UDPLogHookTests).TestUDPHookRecord")
+	c.Assert(rec.Context["domain"], Equals, "example.com")
+}
+
+type StreamHookTests struct{}
+
+var _ = Suite(&StreamHookTests{})
+
+func (s *StreamHookTests) newHook(c *C, server *udploghook.StreamServer, conf udploghook.StreamConfig) (*udploghook.StreamHook, *logrus.Logger) {
+	conf.Address = server.Addr()
+	hook, err := udploghook.NewStream(conf)
+	c.Assert(err, IsNil)
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(hook)
+	return hook, log
+}
+
+func (s *StreamHookTests) TestFraming(c *C) {
+	for _, tt := range []struct {
+		network string
+		framing udploghook.Framing
+	}{
+		{network: "tcp", framing: udploghook.FramingNewline},
+		{network: "tcp", framing: udploghook.FramingLengthPrefix},
+		{network: "unix", framing: udploghook.FramingNewline},
+		{network: "unix", framing: udploghook.FramingLengthPrefix},
+	} {
+		c.Logf("Network %s framing %d", tt.network, tt.framing)
+		address := "127.0.0.1:0"
+		if tt.network == "unix" {
+			address = filepath.Join(c.MkDir(), "udplog.sock")
+		}
+		server, err := udploghook.NewStreamServer(tt.network, address, tt.framing, nil)
+		c.Assert(err, IsNil)
+		hook, log := s.newHook(c, server, udploghook.StreamConfig{Network: tt.network, Framing: tt.framing})
+
+		log.Info("first")
+		log.WithFields(logrus.Fields{"domain": "example.com"}).Warn("second")
+
+		rec, err := server.GetRecord()
+		c.Assert(err, IsNil)
+		c.Assert(rec.Message, Equals, "first")
+		c.Assert(rec.Category, Equals, "logrus")
+		rec, err = server.GetRecord()
+		c.Assert(err, IsNil)
+		c.Assert(rec.Message, Equals, "second")
+		c.Assert(rec.Context["domain"], Equals, "example.com")
+
+		c.Assert(hook.Close(), IsNil)
+		server.Close()
+	}
+}
+
+func (s *StreamHookTests) TestFormatter(c *C) {
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingNewline, nil)
+	c.Assert(err, IsNil)
+	defer server.Close()
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{
+		Formatter: &logrus.TextFormatter{DisableTimestamp: true},
+	})
+
+	log.Info("first")
+	c.Assert(string(server.GetData()), Equals, "logrus:level=info msg=first\n")
+	c.Assert(hook.Close(), IsNil)
+}
+
+func (s *StreamHookTests) TestEncoding(c *C) {
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingLengthPrefix, nil)
+	c.Assert(err, IsNil)
+	defer server.Close()
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{
+		Framing:  udploghook.FramingLengthPrefix,
+		Encoding: encoding.MsgPack,
+	})
+
+	log.WithFields(logrus.Fields{"domain": "example.com"}).Info("first")
+	data := server.GetData()
+	c.Assert(bytes.HasPrefix(data, []byte("logrus:")), Equals, true)
+	rec, err := encoding.Decode(encoding.MsgPack, data[len("logrus:"):])
+	c.Assert(err, IsNil)
+	c.Assert(rec.Message, Equals, "first")
+	c.Assert(rec.Context["domain"], Equals, "example.com")
+	c.Assert(hook.Close(), IsNil)
+
+	// Binary records can not be framed by newlines
+	_, err = udploghook.NewStream(udploghook.StreamConfig{
+		Address:  server.Addr(),
+		Encoding: encoding.MsgPack,
+	})
+	c.Assert(err, ErrorMatches, "encoding 'msgpack' requires FramingLengthPrefix")
+}
+
+func (s *StreamHookTests) TestTLS(c *C) {
+	cert := selfSignedCert(c)
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingNewline,
+		&tls.Config{Certificates: []tls.Certificate{cert}})
+	c.Assert(err, IsNil)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{
+		TLS: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+	})
+	defer hook.Close()
+
+	log.Info("this is a test")
+	req := server.GetRequest()
+	c.Assert(req["message"], Equals, "this is a test")
+}
+
+func (s *StreamHookTests) TestReconnect(c *C) {
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingNewline, nil)
+	c.Assert(err, IsNil)
+	address := server.Addr()
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{ReconnectBackoff: time.Millisecond})
+
+	log.Info("first")
+	c.Assert(server.GetRequest()["message"], Equals, "first")
+
+	// Records logged while the server is down are buffered
+	server.Close()
+	for i := 0; i < 10; i++ {
+		log.Infof("buffered %d", i)
+	}
+	server, err = udploghook.NewStreamServer("tcp", address, udploghook.FramingNewline, nil)
+	c.Assert(err, IsNil)
+	defer server.Close()
+	log.Info("last")
+
+	// Writes which raced the close of the old connection may be lost
+	for {
+		if server.GetRequest()["message"] == "last" {
+			break
+		}
+	}
+	c.Assert(hook.Close(), IsNil)
+}
+
+func (s *StreamHookTests) TestCloseTimeout(c *C) {
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingNewline, nil)
+	c.Assert(err, IsNil)
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{CloseTimeout: 50 * time.Millisecond})
+	server.Close()
+
+	for i := 0; i < 10; i++ {
+		log.Infof("dropped %d", i)
+	}
+	start := time.Now()
+	c.Assert(hook.Close(), IsNil)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+}
+
+func (s *StreamHookTests) TestFireAfterClose(c *C) {
+	server, err := udploghook.NewStreamServer("tcp", "127.0.0.1:0", udploghook.FramingNewline, nil)
+	c.Assert(err, IsNil)
+	defer server.Close()
+	hook, log := s.newHook(c, server, udploghook.StreamConfig{})
+	c.Assert(hook.Close(), IsNil)
+
+	err = hook.Fire(logrus.NewEntry(log))
+	c.Assert(err, ErrorMatches, "hook is closed")
+	// Logging after shutdown does not panic
+	log.Info("after close")
+	c.Assert(hook.Close(), IsNil)
+}
+
+func (s *StreamHookTests) TestUnsupportedNetwork(c *C) {
+	_, err := udploghook.NewStream(udploghook.StreamConfig{Network: "udp", Address: "localhost:1"})
+	c.Assert(err, ErrorMatches, "unsupported network 'udp'")
+}
+
+// Returns a certificate for 127.0.0.1
+func selfSignedCert(c *C) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	leaf, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}